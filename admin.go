@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/searchinform/cache"
+)
+
+// admin wraps handler of admin API with token authentication
+func (ctrl *Controller) admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ctrl.adminToken == "" {
+			ctrl.error(w, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+
+		auth, expected := []byte(r.Header.Get("Authorization")), []byte("Bearer "+ctrl.adminToken)
+		if subtle.ConstantTimeCompare(auth, expected) != 1 {
+			ctrl.error(w, "Admin API: unauthorized request from "+r.RemoteAddr, http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func snapshotFormat(r *http.Request) string {
+	if format := r.FormValue("format"); format != "" {
+		return format
+	}
+	return cache.FormatNDJSON
+}
+
+// ExportCache streams all live cache entries
+func (ctrl *Controller) ExportCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ctrl.error(w, "Export err: invalid method "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := snapshotFormat(r)
+	switch format {
+	case cache.FormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case cache.FormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	default:
+		ctrl.error(w, "Export err: "+cache.ErrFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n, err := cache.Export(&ctrl.cache, w, format)
+	if err != nil {
+		ctrl.logger.Printf("Export [%v]: err : %v", format, err)
+		return
+	}
+	ctrl.logger.Printf("Export [%v]: %v entries", format, n)
+}
+
+// ImportCache loads snapshot from request body into cache
+func (ctrl *Controller) ImportCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ctrl.error(w, "Import err: invalid method "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := snapshotFormat(r)
+	n, err := cache.Import(&ctrl.cache, r.Body, format)
+	if err != nil {
+		ctrl.error(w, "Import err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctrl.logger.Printf("Import [%v]: %v entries", format, n)
+
+	body := &struct {
+		Imported int `json:"imported"`
+	}{Imported: n}
+
+	json.NewEncoder(w).Encode(body)
+}
+
+// CacheEntry returns (GET) or deletes (DELETE) cache entry by key
+func (ctrl *Controller) CacheEntry(w http.ResponseWriter, r *http.Request) {
+	key := r.FormValue("key")
+	if key == "" {
+		ctrl.error(w, "Cache entry err: empty key", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entry, ok := ctrl.cache.Peek(key)
+		if !ok {
+			ctrl.error(w, "Cache entry err: key `"+key+"` not found", http.StatusNotFound)
+			return
+		}
+
+		origin := entry.Origin()
+		body := &struct {
+			Key      string    `json:"key"`
+			Value    string    `json:"value"`
+			Provider string    `json:"provider"`
+			Fetched  time.Time `json:"fetched"`
+			Latency  Duration  `json:"latency"`
+			Inserted time.Time `json:"inserted"`
+			Last     time.Time `json:"last"`
+			Deadline time.Time `json:"deadline"`
+		}{
+			Key:      key,
+			Value:    entry.Value(),
+			Provider: origin.Provider,
+			Fetched:  time.Unix(0, origin.Fetched),
+			Latency:  Duration{origin.Latency},
+			Inserted: time.Unix(0, entry.Inserted()),
+			Last:     time.Unix(0, entry.Last()),
+			Deadline: time.Unix(0, entry.Deadline()),
+		}
+		json.NewEncoder(w).Encode(body)
+
+	case http.MethodDelete:
+		ctrl.invalidate(key)
+		ctrl.logger.Printf("Cache entry [%v]: deleted", key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		ctrl.error(w, "Cache entry err: invalid method "+r.Method, http.StatusMethodNotAllowed)
+	}
+}
+
+// filter - matcher of answers about addr by providers of answer
+type filter func(addr string, providers ...string) bool
+
+// purgeFilter returns filter of answers by CIDR of addr or by provider
+func purgeFilter(cidr, provider string) (filter, error) {
+	switch {
+	case cidr != "" && provider != "":
+		return nil, errors.New("both cidr and provider are set")
+	case cidr != "":
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		return func(addr string, providers ...string) bool {
+			ip := net.ParseIP(addr)
+			return ip != nil && network.Contains(ip)
+		}, nil
+	case provider != "":
+		return func(addr string, providers ...string) bool {
+			for _, p := range providers {
+				if p == provider {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, errors.New("cidr or provider must be set")
+}
+
+// invalidate deletes all answers about addr
+func (ctrl *Controller) invalidate(addr string) {
+	ctrl.cache.Delete(addr)
+	ctrl.consensuses.Delete(addr)
+	ctrl.hostnames.Delete(addr)
+	ctrl.l2.Delete(addr)
+}
+
+// purge deletes answers matched by filter from all caches, hostnames of addrs with deleted countries
+// are deleted too, returns number of deleted entries of in-process cache
+func (ctrl *Controller) purge(match filter) (n int, err error) {
+	deleted := make(map[string]bool)
+	n = ctrl.cache.DeleteFunc(func(addr string, entry *cache.Entry[string]) bool {
+		if !match(addr, entry.Origin().Provider) {
+			return false
+		}
+		deleted[addr] = true
+		return true
+	})
+	ctrl.consensuses.DeleteFunc(func(addr string, entry *cache.Entry[Consensus]) bool {
+		votes := entry.Value().Votes
+		providers := make([]string, 0, len(votes))
+		for _, vote := range votes {
+			providers = append(providers, vote.Provider)
+		}
+		return deleted[addr] || match(addr, providers...)
+	})
+	ctrl.hostnames.DeleteFunc(func(addr string, entry *cache.Entry[string]) bool {
+		return deleted[addr] || match(addr)
+	})
+
+	if _, err = ctrl.l2.DeleteFunc(match); err != nil {
+		return n, errors.New("L2 err : " + err.Error())
+	}
+	return n, nil
+}
+
+// PurgeCache deletes all entries by CIDR (cidr=) or by provider (provider=)
+func (ctrl *Controller) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		ctrl.error(w, "Purge err: invalid method "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	cidr, provider := r.FormValue("cidr"), r.FormValue("provider")
+	match, err := purgeFilter(cidr, provider)
+	if err != nil {
+		ctrl.error(w, "Purge err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n, err := ctrl.purge(match)
+	if err != nil {
+		ctrl.error(w, "Purge err: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	ctrl.logger.Printf("Purge cidr [%v] provider [%v]: %v entries", cidr, provider, n)
+
+	body := &struct {
+		Deleted int `json:"deleted"`
+	}{Deleted: n}
+
+	json.NewEncoder(w).Encode(body)
+}
+
+// FlushCache deletes all entries of all tiers
+func (ctrl *Controller) FlushCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ctrl.error(w, "Flush err: invalid method "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctrl.cache.Flush()
+	ctrl.consensuses.Flush()
+	ctrl.hostnames.Flush()
+	// otherwise the next misses load flushed answers from L2
+	n, err := ctrl.l2.Flush()
+	if err != nil {
+		ctrl.error(w, "Flush err: L2 err : "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	ctrl.logger.Printf("Cache has been flushed (%v answers of L2)", n)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ProviderStats returns rate, latency & health of all providers
+func (ctrl *Controller) ProviderStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ctrl.error(w, "Provider stats err: invalid method "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	type stats struct {
+		Name      string   `json:"name"`
+		Key       string   `json:"key,omitempty"`
+		Rate      int64    `json:"rate"`
+		MaxRate   int64    `json:"max_rate"`
+		Latency   Duration `json:"latency"`
+		ErrorRate float64  `json:"error_rate"`
+		Samples   int64    `json:"samples"`
+		Healthy   bool     `json:"healthy"`
+		Disabled  bool     `json:"disabled"`
+	}
+
+	providers := ctrl.providers.Stats()
+	body := make([]stats, 0, len(providers))
+	for _, p := range providers {
+		body = append(body, stats{
+			Name:      p.Name,
+			Key:       p.Key,
+			Rate:      p.Rate,
+			MaxRate:   p.MaxRate,
+			Latency:   Duration{p.Latency},
+			ErrorRate: p.ErrorRate,
+			Samples:   p.Samples,
+			Healthy:   p.Healthy,
+			Disabled:  p.Disabled,
+		})
+	}
+
+	json.NewEncoder(w).Encode(body)
+}
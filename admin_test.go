@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/searchinform/cache"
+)
+
+// newAdminController returns controller with admin token & L2 served by in-process stand-in
+func newAdminController(t *testing.T) (*Controller, *respServer) {
+	t.Helper()
+
+	srv := newRESPServer(t)
+	ctrl := newTestController(t, testConfig())
+	ctrl.adminToken = "token"
+	ctrl.l2 = newTestL2(srv.listener.Addr().String(), time.Hour, time.Minute, 1)
+	return ctrl, srv
+}
+
+// serveAdmin serves request of admin API with token
+func serveAdmin(ctrl *Controller, handler http.HandlerFunc, method, target string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+ctrl.adminToken)
+	w := httptest.NewRecorder()
+	ctrl.admin(handler)(w, r)
+	return w
+}
+
+// insertAll inserts answer about addr of provider into all caches
+func (ctrl *Controller) insertAll(addr, country, provider string) {
+	origin := cache.Origin{Provider: provider, Fetched: time.Now().UnixNano()}
+	ctrl.cache.InsertFrom(addr, country, origin)
+	ctrl.consensuses.InsertFrom(addr, Consensus{Country: country, Votes: []Vote{{Provider: provider, Country: country}}}, origin)
+	ctrl.hostnames.Insert(addr, "host."+provider)
+	ctrl.l2.Set(addr, country, origin)
+}
+
+// cached returns which caches have answer about addr
+func (ctrl *Controller) cached(addr string) (l1, consensus, hostname, l2 bool) {
+	_, l1 = ctrl.cache.Peek(addr)
+	_, consensus = ctrl.consensuses.Peek(addr)
+	_, hostname = ctrl.hostnames.Peek(addr)
+	_, _, _, l2 = ctrl.l2.Get(context.Background(), addr)
+	return
+}
+
+func TestAdminAuth(t *testing.T) {
+	t.Parallel()
+
+	ctrl := newTestController(t, testConfig())
+	cases := []struct {
+		Token  string
+		Header string
+		Code   int
+	}{
+		{Code: http.StatusForbidden},
+		{Header: "Bearer ", Code: http.StatusForbidden},
+		{Token: "token", Code: http.StatusUnauthorized},
+		{Token: "token", Header: "token", Code: http.StatusUnauthorized},
+		{Token: "token", Header: "Bearer other", Code: http.StatusUnauthorized},
+		{Token: "token", Header: "Bearer token", Code: http.StatusOK},
+	}
+	for i, testCase := range cases {
+		ctrl.adminToken = testCase.Token
+		r := httptest.NewRequest(http.MethodGet, "/admin/providers", nil)
+		if testCase.Header != "" {
+			r.Header.Set("Authorization", testCase.Header)
+		}
+		w := httptest.NewRecorder()
+		ctrl.admin(ctrl.ProviderStats)(w, r)
+		if w.Code != testCase.Code {
+			t.Fatalf("Case [%v]: invalid code %v", i, w.Code)
+		}
+	}
+}
+
+func TestAdminCacheEntry(t *testing.T) {
+	t.Parallel()
+
+	ctrl, _ := newAdminController(t)
+	ctrl.insertAll("1.2.3.4", "Testland", "p")
+
+	w := serveAdmin(ctrl, ctrl.CacheEntry, http.MethodGet, "/admin/cache/entry?key=1.2.3.4", nil)
+	var body struct {
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		Provider string `json:"provider"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Invalid entry: %v err: %v", w.Code, err)
+	}
+	if body.Key != "1.2.3.4" || body.Value != "Testland" || body.Provider != "p" {
+		t.Fatalf("Invalid entry: %+v", body)
+	}
+
+	if w := serveAdmin(ctrl, ctrl.CacheEntry, http.MethodDelete, "/admin/cache/entry?key=1.2.3.4", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Invalid code of deletion %v", w.Code)
+	}
+	if l1, consensus, hostname, l2 := ctrl.cached("1.2.3.4"); l1 || consensus || hostname || l2 {
+		t.Fatalf("Deleted answer is cached: %v %v %v %v", l1, consensus, hostname, l2)
+	}
+
+	for i, testCase := range []struct {
+		Method, Target string
+		Code           int
+	}{
+		{http.MethodGet, "/admin/cache/entry?key=1.2.3.4", http.StatusNotFound},
+		{http.MethodGet, "/admin/cache/entry", http.StatusBadRequest},
+		{http.MethodPost, "/admin/cache/entry?key=1.2.3.4", http.StatusMethodNotAllowed},
+	} {
+		if w := serveAdmin(ctrl, ctrl.CacheEntry, testCase.Method, testCase.Target, nil); w.Code != testCase.Code {
+			t.Fatalf("Case [%v]: invalid code %v", i, w.Code)
+		}
+	}
+}
+
+func TestAdminPurgeCache(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Query   string
+		Deleted []string
+	}{
+		{Query: "cidr=10.0.0.0/8", Deleted: []string{"10.0.0.1", "10.1.2.3"}},
+		{Query: "provider=b", Deleted: []string{"10.1.2.3", "192.168.0.1"}},
+	}
+	for i, testCase := range cases {
+		ctrl, _ := newAdminController(t)
+		ctrl.insertAll("10.0.0.1", "Testland", "a")
+		ctrl.insertAll("10.1.2.3", "Testland", "b")
+		ctrl.insertAll("192.168.0.1", "Testland", "b")
+		ctrl.insertAll("1.2.3.4", "Testland", "a")
+
+		w := serveAdmin(ctrl, ctrl.PurgeCache, http.MethodPost, "/admin/cache/purge?"+testCase.Query, nil)
+		var body struct {
+			Deleted int `json:"deleted"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Case [%v]: invalid answer %v err: %v", i, w.Code, err)
+		}
+		if body.Deleted != len(testCase.Deleted) {
+			t.Fatalf("Case [%v]: %v entries are deleted, but must be %v", i, body.Deleted, len(testCase.Deleted))
+		}
+
+		deleted := make(map[string]bool)
+		for _, addr := range testCase.Deleted {
+			deleted[addr] = true
+		}
+		for _, addr := range []string{"10.0.0.1", "10.1.2.3", "192.168.0.1", "1.2.3.4"} {
+			l1, consensus, hostname, l2 := ctrl.cached(addr)
+			if l1 == deleted[addr] || consensus == deleted[addr] || hostname == deleted[addr] || l2 == deleted[addr] {
+				t.Fatalf("Case [%v]: invalid purge of %v: %v %v %v %v", i, addr, l1, consensus, hostname, l2)
+			}
+		}
+	}
+
+	ctrl, _ := newAdminController(t)
+	for i, testCase := range []struct {
+		Method, Target string
+		Code           int
+	}{
+		{http.MethodPost, "/admin/cache/purge", http.StatusBadRequest},
+		{http.MethodPost, "/admin/cache/purge?cidr=10.0.0.0/8&provider=a", http.StatusBadRequest},
+		{http.MethodPost, "/admin/cache/purge?cidr=10.0.0.0", http.StatusBadRequest},
+		{http.MethodGet, "/admin/cache/purge?provider=a", http.StatusMethodNotAllowed},
+	} {
+		if w := serveAdmin(ctrl, ctrl.PurgeCache, testCase.Method, testCase.Target, nil); w.Code != testCase.Code {
+			t.Fatalf("Case [%v]: invalid code %v", i, w.Code)
+		}
+	}
+}
+
+func TestAdminFlushCache(t *testing.T) {
+	t.Parallel()
+
+	ctrl, srv := newAdminController(t)
+	ctrl.insertAll("1.2.3.4", "Testland", "a")
+	ctrl.insertAll("5.6.7.8", "Testland", "b")
+
+	if w := serveAdmin(ctrl, ctrl.FlushCache, http.MethodGet, "/admin/cache/flush", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Invalid code %v", w.Code)
+	}
+	if w := serveAdmin(ctrl, ctrl.FlushCache, http.MethodPost, "/admin/cache/flush", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Invalid code %v", w.Code)
+	}
+	for _, addr := range []string{"1.2.3.4", "5.6.7.8"} {
+		if l1, consensus, hostname, l2 := ctrl.cached(addr); l1 || consensus || hostname || l2 {
+			t.Fatalf("Flushed answer about %v is cached: %v %v %v %v", addr, l1, consensus, hostname, l2)
+		}
+	}
+	if n := srv.Len(); n != 0 {
+		t.Fatalf("L2 must be empty, but %v values", n)
+	}
+}
+
+func TestAdminExportImport(t *testing.T) {
+	t.Parallel()
+
+	src := newTestController(t, testConfig())
+	src.adminToken = "token"
+	src.cache.InsertFrom("1.2.3.4", "Testland", cache.Origin{Provider: "a", Fetched: time.Now().UnixNano()})
+	src.cache.InsertFrom("5.6.7.8", "Otherland", cache.Origin{Provider: "b", Fetched: time.Now().UnixNano()})
+
+	w := serveAdmin(src, src.ExportCache, http.MethodGet, "/admin/cache/export?format=csv", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("Invalid export: %v %v", w.Code, w.Header().Get("Content-Type"))
+	}
+	snapshot := w.Body.Bytes()
+	if !strings.HasPrefix(string(snapshot), "key,value,deadline,provider,fetched,latency\n") {
+		t.Fatalf("Invalid CSV snapshot:\n%s", snapshot)
+	}
+
+	dst := newTestController(t, testConfig())
+	dst.adminToken = "token"
+	w = serveAdmin(dst, dst.ImportCache, http.MethodPost, "/admin/cache/import?format=csv", snapshot)
+	var body struct {
+		Imported int `json:"imported"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != http.StatusOK || body.Imported != 2 {
+		t.Fatalf("Invalid import: %v %+v err: %v", w.Code, body, err)
+	}
+	for addr, country := range map[string]string{"1.2.3.4": "Testland", "5.6.7.8": "Otherland"} {
+		entry, ok := dst.cache.Peek(addr)
+		if !ok || entry.Value() != country {
+			t.Fatalf("Invalid imported answer about %v: %v", addr, ok)
+		}
+		if original, _ := src.cache.Peek(addr); entry.Origin() != original.Origin() || entry.Deadline()/1e9 != original.Deadline()/1e9 {
+			t.Fatalf("Invalid imported origin about %v: %+v", addr, entry.Origin())
+		}
+	}
+
+	for i, testCase := range []struct {
+		Handler        http.HandlerFunc
+		Method, Target string
+	}{
+		{dst.ExportCache, http.MethodGet, "/admin/cache/export?format=xml"},
+		{dst.ExportCache, http.MethodPost, "/admin/cache/export"},
+		{dst.ImportCache, http.MethodPost, "/admin/cache/import?format=xml"},
+		{dst.ImportCache, http.MethodGet, "/admin/cache/import"},
+	} {
+		if w := serveAdmin(dst, testCase.Handler, testCase.Method, testCase.Target, nil); w.Code < 400 {
+			t.Fatalf("Case [%v]: invalid code %v", i, w.Code)
+		}
+	}
+}
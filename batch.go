@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/searchinform/batch"
+	"github.com/searchinform/cache"
+	"github.com/searchinform/provider"
+)
+
+// newBatchers returns batchers of providers with batch calls
+func (ctrl *Controller) newBatchers() map[*provider.Provider]*batch.Batcher[string, *answer] {
+	batchers := make(map[*provider.Provider]*batch.Batcher[string, *answer])
+	for _, p := range ctrl.providers.Providers() {
+		if p.Batch != nil {
+			batchers[p] = batch.New(p.Batch.Duration(), p.Batch.Size, ctrl.batchCall(p))
+		}
+	}
+	return batchers
+}
+
+// batchCall returns batch call of provider p
+func (ctrl *Controller) batchCall(p *provider.Provider) batch.Call[string, *answer] {
+	return func(addrs []string) ([]*answer, error) {
+		start := time.Now()
+		answers, err := ctrl.client.ResolveBatch(context.Background(), p, addrs)
+		now := time.Now()
+		ctrl.report(p, now.Sub(start), err)
+		if err != nil {
+			return nil, err
+		}
+
+		ctrl.logger.Printf("Batch call: provider [%v]: %v addrs: latency %v", p.Name, len(addrs), now.Sub(start))
+		origin := cache.Origin{Provider: p.Name, Fetched: now.UnixNano(), Latency: now.Sub(start)}
+		values := make([]*answer, 0, len(answers))
+		for _, a := range answers {
+			values = append(values, &answer{provider: p, country: a.Country, origin: origin, err: a.Err})
+		}
+		return values, nil
+	}
+}
+
+// fetchBatch returns answer of provider p about addr from batch call,
+// request counted in this second is released if addr has joined batch of other request
+func (ctrl *Controller) fetchBatch(ctx context.Context, b *batch.Batcher[string, *answer], p *provider.Provider,
+	addr string, counted int64) *answer {
+
+	ticket, opened := b.Join(addr)
+	if !opened && !p.Batch.PerIP() {
+		ctrl.providers.Release(p, counted) // batch call is paid by its opener
+	}
+	ans, err := ticket.Wait(ctx)
+	if err != nil {
+		return &answer{provider: p, err: err}
+	}
+	return ans
+}
@@ -0,0 +1,123 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Call - batch call, returns values of keys in the same order
+type Call[K comparable, V any] func(keys []K) ([]V, error)
+
+// pending - batch, which accumulates keys
+type pending[K comparable, V any] struct {
+	keys    []K
+	indexes map[K]int // indexes of keys (duplicates share value)
+	done    chan struct{}
+
+	// set before done is closed
+	values []V
+	err    error
+}
+
+// Batcher - accumulates keys for window (or until batch is full) and makes one call
+// for all of them, values are fanned out to waiters
+type Batcher[K comparable, V any] struct {
+	call   Call[K, V]
+	window time.Duration
+	size   int
+
+	mu   sync.Mutex
+	open *pending[K, V] // nil if there is no accumulating batch
+}
+
+// New - constructor for Batcher struct
+func New[K comparable, V any](window time.Duration, size int, call Call[K, V]) *Batcher[K, V] {
+	return &Batcher[K, V]{
+		call:   call,
+		window: window,
+		size:   size,
+	}
+}
+
+// Ticket - key, which has joined batch
+type Ticket[K comparable, V any] struct {
+	p     *pending[K, V]
+	index int
+}
+
+// Wait waits for value of key until ctx is done (batch call isn't cancelled)
+func (t Ticket[K, V]) Wait(ctx context.Context) (value V, err error) {
+	select {
+	case <-t.p.done:
+	case <-ctx.Done():
+		return value, ctx.Err()
+	}
+	if t.p.err != nil {
+		return value, t.p.err
+	}
+	return t.p.values[t.index], nil
+}
+
+// Join adds key to accumulating batch (or opens new one) without waiting for its value,
+// opened is true if key has opened batch
+func (b *Batcher[K, V]) Join(key K) (ticket Ticket[K, V], opened bool) {
+	p, index, opened := b.add(key)
+	return Ticket[K, V]{p: p, index: index}, opened
+}
+
+// Do adds key to accumulating batch (or opens new one) and waits for its value until ctx is done
+// (batch call isn't cancelled), opened is true if key has opened batch
+func (b *Batcher[K, V]) Do(ctx context.Context, key K) (value V, opened bool, err error) {
+	ticket, opened := b.Join(key)
+	value, err = ticket.Wait(ctx)
+	return value, opened, err
+}
+
+func (b *Batcher[K, V]) add(key K) (p *pending[K, V], index int, opened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if p = b.open; p == nil {
+		p = &pending[K, V]{indexes: make(map[K]int, b.size), done: make(chan struct{})}
+		b.open, opened = p, true
+		time.AfterFunc(b.window, func() { b.flush(p) })
+	}
+
+	index, ok := p.indexes[key]
+	if !ok {
+		index = len(p.keys)
+		p.indexes[key] = index
+		p.keys = append(p.keys, key)
+	}
+
+	if len(p.keys) >= b.size {
+		b.open = nil
+		go b.run(p)
+	}
+	return p, index, opened
+}
+
+// flush runs batch p if it's still accumulating
+func (b *Batcher[K, V]) flush(p *pending[K, V]) {
+	b.mu.Lock()
+	if b.open != p {
+		b.mu.Unlock()
+		return
+	}
+	b.open = nil
+	b.mu.Unlock()
+
+	b.run(p)
+}
+
+func (b *Batcher[K, V]) run(p *pending[K, V]) {
+	p.values, p.err = b.call(p.keys)
+	if p.err == nil && len(p.values) != len(p.keys) {
+		p.err = errors.New("batch call returns " + strconv.Itoa(len(p.values)) +
+			" values for " + strconv.Itoa(len(p.keys)) + " keys")
+	}
+	close(p.done)
+}
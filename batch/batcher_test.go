@@ -0,0 +1,133 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatcherWindow(t *testing.T) {
+	t.Parallel()
+
+	var calls int64
+	batcher := New[string, string](50*time.Millisecond, 100, func(keys []string) ([]string, error) {
+		atomic.AddInt64(&calls, 1)
+		values := make([]string, 0, len(keys))
+		for _, key := range keys {
+			values = append(values, strings.ToUpper(key))
+		}
+		return values, nil
+	})
+
+	keys := []string{"a", "b", "c", "a"}
+	var (
+		wg     sync.WaitGroup
+		opened int64
+	)
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			value, open, err := batcher.Do(context.Background(), key)
+			if err != nil || value != strings.ToUpper(key) {
+				t.Errorf("Key [%v]: invalid value `%v` or err: %v", key, value, err)
+			}
+			if open {
+				atomic.AddInt64(&opened, 1)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if calls != 1 || opened != 1 {
+		t.Fatalf("Must be one call, but calls: %v, opened: %v", calls, opened)
+	}
+}
+
+func TestBatcherSize(t *testing.T) {
+	t.Parallel()
+
+	var sizes []int
+	var mu sync.Mutex
+	batcher := New[int, int](time.Hour, 2, func(keys []int) ([]int, error) {
+		mu.Lock()
+		sizes = append(sizes, len(keys))
+		mu.Unlock()
+		return keys, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if value, _, err := batcher.Do(context.Background(), i); err != nil || value != i {
+				t.Errorf("Key [%v]: invalid value %v or err: %v", i, value, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 2 {
+		t.Fatalf("Must be two full batches, but sizes: %v", sizes)
+	}
+}
+
+func TestBatcherError(t *testing.T) {
+	t.Parallel()
+
+	failure := errors.New("failure")
+	batcher := New[int, int](time.Millisecond, 10, func(keys []int) ([]int, error) {
+		return nil, failure
+	})
+	if _, opened, err := batcher.Do(context.Background(), 1); err != failure || !opened {
+		t.Fatalf("Must be err: %v, but %v (opened %v)", failure, err, opened)
+	}
+
+	batcher = New[int, int](time.Millisecond, 10, func(keys []int) ([]int, error) {
+		return []int{}, nil
+	})
+	if _, _, err := batcher.Do(context.Background(), 1); err == nil {
+		t.Fatal("No error of missing values")
+	}
+}
+
+func TestBatcherContext(t *testing.T) {
+	t.Parallel()
+
+	batcher := New[int, int](time.Hour, 10, func(keys []int) ([]int, error) {
+		return keys, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, opened, err := batcher.Do(ctx, 1); err != context.DeadlineExceeded || !opened {
+		t.Fatalf("Must be err: %v, but %v (opened %v)", context.DeadlineExceeded, err, opened)
+	}
+}
+
+func TestBatcherJoin(t *testing.T) {
+	t.Parallel()
+
+	batcher := New[int, int](time.Hour, 2, func(keys []int) ([]int, error) {
+		return keys, nil
+	})
+
+	// keys are joined before value is ready
+	first, opened := batcher.Join(1)
+	if !opened {
+		t.Fatal("First key must open batch")
+	}
+	second, opened := batcher.Join(2)
+	if opened {
+		t.Fatal("Second key mustn't open batch")
+	}
+	for i, ticket := range []Ticket[int, int]{first, second} {
+		if value, err := ticket.Wait(context.Background()); err != nil || value != i+1 {
+			t.Fatalf("Ticket [%v]: invalid value %v err: %v", i, value, err)
+		}
+	}
+}
@@ -2,49 +2,122 @@ package cache
 
 import (
 	"context"
-	"hash/fnv"
 	"sync/atomic"
 	"time"
 )
 
-// ValueType ...
+// ValueType - value type of default (string) cache
 type ValueType = string
 
+// Hasher returns hash of key
+type Hasher[K comparable] func(key K) uint32
+
+// FNV-1a constants
+const (
+	offset32 = 2166136261
+	prime32  = 16777619
+)
+
+// StringHasher - FNV-1a hash of string (without allocations)
+func StringHasher(key string) uint32 {
+	hash := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
+
+// Origin - source of cached value
+type Origin struct {
+	Provider string        // name of provider, which has resolved value
+	Fetched  int64         // time of fetch from provider (in UnixNano)
+	Latency  time.Duration // upstream latency
+}
+
 // Entry - internal cache entry
-type Entry struct {
-	val      ValueType
+type Entry[V any] struct {
+	val      V
+	origin   Origin
+	inserted int64 // in UnixNano
 	last     int64 // time of last data access (in UnixNano)
 	deadline int64 // in UnixNano
 }
 
+// Value ...
+func (e *Entry[V]) Value() V {
+	return e.val
+}
+
+// Origin ...
+func (e *Entry[V]) Origin() Origin {
+	return e.origin
+}
+
+// Inserted - time of insertion in UnixNano
+func (e *Entry[V]) Inserted() int64 {
+	return e.inserted
+}
+
+// Last - time of last data access in UnixNano
+func (e *Entry[V]) Last() int64 {
+	return atomic.LoadInt64(&e.last)
+}
+
 // Deadline - deadline in UnixNano
-func (e *Entry) Deadline() int64 {
+func (e *Entry[V]) Deadline() int64 {
 	return atomic.LoadInt64(&e.deadline)
 }
 
 // Cache - lock-free hash map
-type Cache struct {
-	partitions []list
+type Cache[K comparable, V any] struct {
+	partitions []list[K, V]
+	hasher     Hasher[K]
 	ttl        time.Duration
+	policy     Policy
+	wheel      *wheel[K, V]
 }
 
-// NewCache - create
-func NewCache(npartitions int, ttl time.Duration) *Cache {
-	return &Cache{
-		partitions: make([]list, npartitions),
+// New - create cache with custom key & value types
+func New[K comparable, V any](npartitions int, ttl time.Duration, hasher Hasher[K], policy Policy) *Cache[K, V] {
+	return &Cache[K, V]{
+		partitions: make([]list[K, V], npartitions),
+		hasher:     hasher,
 		ttl:        ttl,
+		policy:     policy,
+		wheel:      newWheel[K, V](wheelTick, wheelSlots, time.Now()),
 	}
 }
 
-func (c *Cache) partition(key string) *list {
-	hasher := fnv.New32a()
-	hasher.Write([]byte(key))
-	index := hasher.Sum32() % uint32(len(c.partitions))
-	return &c.partitions[index]
+// NewCache - create string cache
+func NewCache(npartitions int, ttl time.Duration) *Cache[string, ValueType] {
+	return NewCacheWithPolicy(npartitions, ttl, Policy{})
+}
+
+// NewCacheWithPolicy - create string cache with TTL policy
+func NewCacheWithPolicy(npartitions int, ttl time.Duration, policy Policy) *Cache[string, ValueType] {
+	return New[string, ValueType](npartitions, ttl, StringHasher, policy)
+}
+
+func (c *Cache[K, V]) index(key K) int {
+	return int(c.hasher(key) % uint32(len(c.partitions)))
+}
+
+func (c *Cache[K, V]) partition(key K) *list[K, V] {
+	return &c.partitions[c.index(key)]
 }
 
 // Get ...
-func (c *Cache) Get(key string) (value ValueType, ok bool) {
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	entry, ok := c.Lookup(key)
+	if !ok {
+		return
+	}
+	return entry.val, true
+}
+
+// Lookup returns live entry and updates time of its last data access
+func (c *Cache[K, V]) Lookup(key K) (entry *Entry[V], ok bool) {
 	partition := c.partition(key)
 	entry, okey := partition.Get(key)
 	if !okey {
@@ -56,7 +129,7 @@ func (c *Cache) Get(key string) (value ValueType, ok bool) {
 	// check deadline
 	if deadline := entry.Deadline(); now > deadline {
 		partition.Delete(key)
-		return
+		return nil, false
 	}
 
 	// update time of last data access
@@ -67,58 +140,116 @@ func (c *Cache) Get(key string) (value ValueType, ok bool) {
 		}
 	}
 
-	return entry.val, true
+	return entry, true
+}
+
+// Peek returns live entry without update of time of last data access
+func (c *Cache[K, V]) Peek(key K) (entry *Entry[V], ok bool) {
+	entry, ok = c.partition(key).Get(key)
+	if !ok || time.Now().UnixNano() > entry.Deadline() {
+		return nil, false
+	}
+	return entry, true
 }
 
 // Delete ...
-func (c *Cache) Delete(key string) {
+func (c *Cache[K, V]) Delete(key K) {
 	partition := c.partition(key)
 	partition.Delete(key)
 }
 
+// DeleteFunc deletes all entries, for which fn returns true, returns number of deleted entries
+func (c *Cache[K, V]) DeleteFunc(fn func(key K, entry *Entry[V]) bool) (n int) {
+	for i := range c.partitions {
+		partition := &c.partitions[i]
+		for this := partition.Head(); this != nil; this = this.Next() {
+			if fn(this.key, this.value) && partition.tryRemove(this) {
+				n++
+			}
+		}
+	}
+	return
+}
+
+// Flush deletes all entries
+func (c *Cache[K, V]) Flush() {
+	for i := range c.partitions {
+		c.partitions[i].clear()
+	}
+}
+
 // Insert ...
-func (c *Cache) Insert(key string, value ValueType) {
-	partition := c.partition(key)
+func (c *Cache[K, V]) Insert(key K, value V) {
+	c.InsertFrom(key, value, Origin{})
+}
 
-	now := time.Now()
-	entry := &Entry{
+// InsertFrom inserts value with its origin, TTL is chosen by policy
+func (c *Cache[K, V]) InsertFrom(key K, value V, origin Origin) {
+	c.InsertWithTTL(key, value, origin, c.TTL(origin))
+}
+
+// InsertWithTTL inserts value with its origin & custom TTL
+func (c *Cache[K, V]) InsertWithTTL(key K, value V, origin Origin, ttl time.Duration) {
+	now := time.Now().UnixNano()
+	c.insert(key, &Entry[V]{
 		val:      value,
-		last:     now.UnixNano(),
-		deadline: now.Add(c.ttl).UnixNano(),
+		origin:   origin,
+		inserted: now,
+		last:     now,
+		deadline: now + int64(ttl),
+	})
+}
+
+// TTL returns TTL of value with this origin by policy
+func (c *Cache[K, V]) TTL(origin Origin) time.Duration {
+	return c.policy.TTL(c.ttl, origin)
+}
+
+func (c *Cache[K, V]) insert(key K, entry *Entry[V]) {
+	index := c.index(key)
+	c.wheel.add(index, c.partitions[index].Insert(key, entry))
+}
+
+// Range calls fn for each entry of cache, including expired ones before compaction
+// (stops if fn returns false)
+func (c *Cache[K, V]) Range(fn func(key K, entry *Entry[V]) bool) {
+	for i := range c.partitions {
+		for this := c.partitions[i].Head(); this != nil; this = this.Next() {
+			if !fn(this.key, this.value) {
+				return
+			}
+		}
+	}
+}
+
+// expire removes entries expired before now (in UnixNano), returns number of removed entries.
+// Expired node isn't unlinked at once, because unlinking from lock-free list costs walk from its head:
+// partition is compacted by one walk, when half of its nodes have expired, so cost of expiry
+// is O(1) amortized per expired entry (expired nodes are invisible for Get until compaction)
+func (c *Cache[K, V]) expire(now int64) (n int) {
+	for _, t := range c.wheel.advance(now) {
+		if t.stale() {
+			continue
+		}
+		partition := &c.partitions[t.partition]
+		if expired := atomic.AddInt64(&partition.expired, 1); 2*expired >= atomic.LoadInt64(&partition.length) {
+			n += partition.compact(now)
+		}
 	}
-	partition.Insert(key, entry)
+	return
 }
 
 // Cleaner - goroutine, which drop all elements after deadline
-func Cleaner(ctx context.Context, cache *Cache) {
-	wait := cache.ttl
+func Cleaner[K comparable, V any](ctx context.Context, cache *Cache[K, V]) {
+	ticker := time.NewTicker(time.Duration(cache.wheel.tick))
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(wait):
-		}
-
-		now := time.Now().UnixNano()
-
-		minDeadline := now + int64(cache.ttl)
-		for i := range cache.partitions {
-			partition := &cache.partitions[i]
-			for entry := partition.Head(); entry != nil; entry.Next() {
-				deadline := entry.value.Deadline()
-
-				// remove if expired
-				if now > deadline {
-					partition.tryRemove(entry)
-				}
-
-				// update min deadline
-				if minDeadline > deadline {
-					minDeadline = deadline
-				}
-			}
+		case now := <-ticker.C:
+			cache.expire(now.UnixNano())
 		}
-
-		wait = time.Duration(minDeadline - now)
 	}
 }
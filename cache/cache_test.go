@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"hash/fnv"
 	"strconv"
 	"testing"
 	"time"
@@ -61,3 +62,68 @@ func TestCache(t *testing.T) {
 		}
 	})
 }
+
+func TestCacheDeleteFunc(t *testing.T) {
+	t.Parallel()
+
+	l := NewCache(4, TTL)
+	l.InsertFrom("zero", "0", Origin{Provider: "a"})
+	l.InsertFrom("one", "1", Origin{Provider: "b"})
+	l.InsertFrom("two", "2", Origin{Provider: "a"})
+
+	n := l.DeleteFunc(func(key string, entry *Entry[ValueType]) bool {
+		return entry.Origin().Provider == "a"
+	})
+	if n != 2 {
+		t.Fatalf("Invalid number of deleted entries: expected: 2, but %v", n)
+	}
+	for _, key := range []string{"zero", "two"} {
+		if value, ok := l.Get(key); ok {
+			t.Fatalf("Key `%s` has been deleted, but returns %v %v", key, value, ok)
+		}
+	}
+	if entry, ok := l.Peek("one"); !ok || entry.Value() != "1" || entry.Origin().Provider != "b" {
+		t.Fatalf("Peek `one` failed: expected: 1 from b, but %v %v", entry, ok)
+	}
+
+	l.Flush()
+	if value, ok := l.Get("one"); ok {
+		t.Fatalf("Cache has been flushed, but returns %v %v", value, ok)
+	}
+}
+
+func TestStringHasher(t *testing.T) {
+	t.Parallel()
+
+	for _, key := range []string{"", "a", "192.140.253.113", "google.com"} {
+		hasher := fnv.New32a()
+		hasher.Write([]byte(key))
+		if expected, hash := hasher.Sum32(), StringHasher(key); hash != expected {
+			t.Fatalf("Hash of `%s`: expected: %v, but %v", key, expected, hash)
+		}
+	}
+}
+
+func TestCacheGeneric(t *testing.T) {
+	t.Parallel()
+
+	type record struct {
+		Addrs []string
+		Err   string
+	}
+
+	l := New[int, record](4, TTL, func(key int) uint32 { return uint32(key) }, Policy{})
+	for i := 0; i < 16; i++ {
+		l.Insert(i, record{Addrs: []string{strconv.Itoa(i)}})
+	}
+	for i := 0; i < 16; i++ {
+		if value, ok := l.Get(i); !ok || len(value.Addrs) != 1 || value.Addrs[0] != strconv.Itoa(i) {
+			t.Fatalf("Get `%v` failed: expected: %v, but %v %v", i, i, value, ok)
+		}
+	}
+
+	l.Delete(3)
+	if value, ok := l.Get(3); ok {
+		t.Fatalf("Key `3` has been deleted, but returns %v %v", value, ok)
+	}
+}
@@ -5,35 +5,46 @@ import (
 	"unsafe"
 )
 
-// ListValue ...
-type listValue = *Entry
-
 // node of list
-type node struct {
-	next unsafe.Pointer // real type is *node
+type node[K comparable, V any] struct {
+	next unsafe.Pointer // real type is *node[K, V]
+
+	key     K
+	value   *Entry[V]
+	removed int32 // node has been unlinked from list
+}
 
-	key   string
-	value listValue
+func (n *node[K, V]) isRemoved() bool {
+	return atomic.LoadInt32(&n.removed) != 0
 }
 
-func loadNode(ptr *unsafe.Pointer) *node {
-	return (*node)(atomic.LoadPointer(ptr))
+func loadNode[K comparable, V any](ptr *unsafe.Pointer) *node[K, V] {
+	return (*node[K, V])(atomic.LoadPointer(ptr))
 }
 
-func (n *node) Next() *node {
-	return loadNode(&n.next)
+func (n *node[K, V]) Next() *node[K, V] {
+	return loadNode[K, V](&n.next)
 }
 
 // list - lock-free list for Hash map
-type list struct {
-	head unsafe.Pointer // real type is *node
+type list[K comparable, V any] struct {
+	head    unsafe.Pointer // real type is *node[K, V]
+	length  int64          // number of linked nodes
+	expired int64          // number of linked nodes, which timers have expired since last compaction
+}
+
+// unlinked registers unlinking of node from list
+func (l *list[K, V]) unlinked(n *node[K, V]) {
+	if atomic.CompareAndSwapInt32(&n.removed, 0, 1) {
+		atomic.AddInt64(&l.length, -1)
+	}
 }
 
-func (l *list) Head() *node {
-	return (*node)(atomic.LoadPointer(&l.head))
+func (l *list[K, V]) Head() *node[K, V] {
+	return loadNode[K, V](&l.head)
 }
 
-func find(start *node, key string) *node {
+func find[K comparable, V any](start *node[K, V], key K) *node[K, V] {
 	for this := start; this != nil; this = this.Next() {
 		if this.key == key {
 			return this
@@ -42,10 +53,10 @@ func find(start *node, key string) *node {
 	return nil
 }
 
-func (l *list) tryRemove(entry *node) bool {
+func (l *list[K, V]) tryRemove(entry *node[K, V]) bool {
 	indirect := &l.head
 
-	for this := loadNode(indirect); this != entry; this = loadNode(indirect) {
+	for this := loadNode[K, V](indirect); this != entry; this = loadNode[K, V](indirect) {
 		// already deleted by another thread
 		if this == nil {
 			return false
@@ -54,17 +65,39 @@ func (l *list) tryRemove(entry *node) bool {
 	}
 
 	old, new := unsafe.Pointer(entry), atomic.LoadPointer(&entry.next)
-	return atomic.CompareAndSwapPointer(indirect, old, new)
+	if !atomic.CompareAndSwapPointer(indirect, old, new) {
+		return false
+	}
+	l.unlinked(entry)
+	return true
 }
 
-func (l *list) Get(key string) (value listValue, ok bool) {
+// removeExpired removes all nodes expired before now, returns number of removed nodes
+func (l *list[K, V]) removeExpired(now int64) (n int) {
+	indirect := &l.head
+	for this := loadNode[K, V](indirect); this != nil; this = loadNode[K, V](indirect) {
+		if now > this.value.Deadline() {
+			// on failure list has been changed, so check indirect again
+			old, new := unsafe.Pointer(this), atomic.LoadPointer(&this.next)
+			if atomic.CompareAndSwapPointer(indirect, old, new) {
+				l.unlinked(this)
+				n++
+			}
+			continue
+		}
+		indirect = &this.next
+	}
+	return
+}
+
+func (l *list[K, V]) Get(key K) (value *Entry[V], ok bool) {
 	if entry := find(l.Head(), key); entry != nil {
 		return entry.value, true
 	}
 	return
 }
 
-func (l *list) Delete(key string) {
+func (l *list[K, V]) Delete(key K) {
 	for entry := find(l.Head(), key); entry != nil; entry = find(l.Head(), key) {
 		if ok := l.tryRemove(entry); ok {
 			break
@@ -72,9 +105,24 @@ func (l *list) Delete(key string) {
 	}
 }
 
-func (l *list) Insert(key string, value listValue) {
+// compact removes all nodes expired before now by one walk, returns number of removed nodes
+func (l *list[K, V]) compact(now int64) int {
+	atomic.StoreInt64(&l.expired, 0)
+	return l.removeExpired(now)
+}
+
+// clear unlinks all nodes
+func (l *list[K, V]) clear() {
+	for this := (*node[K, V])(atomic.SwapPointer(&l.head, nil)); this != nil; this = this.Next() {
+		l.unlinked(this)
+	}
+	atomic.StoreInt64(&l.expired, 0)
+}
+
+// Insert pushes node with key & value to the top of list, returns new node
+func (l *list[K, V]) Insert(key K, value *Entry[V]) *node[K, V] {
 	// push to the top
-	ptr := &node{
+	ptr := &node[K, V]{
 		key:   key,
 		value: value,
 	}
@@ -85,6 +133,7 @@ func (l *list) Insert(key string, value listValue) {
 			break
 		}
 	}
+	atomic.AddInt64(&l.length, 1)
 
 	// remove all old nodes before new one
 	for {
@@ -94,4 +143,5 @@ func (l *list) Insert(key string, value listValue) {
 		}
 		l.tryRemove(entry)
 	}
+	return ptr
 }
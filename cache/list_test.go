@@ -5,18 +5,18 @@ import "testing"
 func TestList(t *testing.T) {
 	t.Parallel()
 
-	entries := make([]*Entry, 4)
+	entries := make([]*Entry[ValueType], 4)
 	for i := range entries {
-		entries[i] = &Entry{}
+		entries[i] = &Entry[ValueType]{}
 	}
 
 	t.Run("insert+get", func(t *testing.T) {
-		l := &list{}
+		l := &list[string, ValueType]{}
 
 		// positive
 		cases := []struct {
 			Key   string
-			Value listValue
+			Value *Entry[ValueType]
 		}{
 			{Key: "zero", Value: entries[0]},
 			{Key: "one", Value: entries[1]},
@@ -40,7 +40,7 @@ func TestList(t *testing.T) {
 	})
 
 	t.Run("delete", func(t *testing.T) {
-		l := &list{}
+		l := &list[string, ValueType]{}
 		l.Insert("zero", entries[0])
 		l.Insert("one", entries[1])
 		l.Insert("two", entries[2])
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Policy - TTL policy of inserted values
+type Policy struct {
+	Min       time.Duration            // min TTL (ignored if zero)
+	Max       time.Duration            // max TTL (ignored if zero)
+	Jitter    float64                  // max random deviation of TTL as fraction of TTL
+	Providers map[string]time.Duration // TTL overrides per provider
+}
+
+// TTL returns TTL of value with this origin, ttl is default TTL
+func (p *Policy) TTL(ttl time.Duration, origin Origin) time.Duration {
+	return p.ttl(ttl, origin, rand.Float64())
+}
+
+// Limit returns the longest TTL of value with this origin (e.g. of imported one): max TTL if it's set,
+// otherwise TTL of origin with the largest jitter
+func (p *Policy) Limit(ttl time.Duration, origin Origin) time.Duration {
+	if p.Max > 0 {
+		return p.Max
+	}
+	return p.ttl(ttl, origin, 1)
+}
+
+// ttl with random value from [0, 1)
+func (p *Policy) ttl(ttl time.Duration, origin Origin, random float64) time.Duration {
+	if override, ok := p.Providers[origin.Provider]; ok {
+		ttl = override
+	}
+
+	// jitter avoids synchronized expiry of entries inserted at the same time
+	if p.Jitter > 0 {
+		ttl += time.Duration((2*random - 1) * p.Jitter * float64(ttl))
+	}
+
+	if p.Min > 0 && ttl < p.Min {
+		ttl = p.Min
+	}
+	if p.Max > 0 && ttl > p.Max {
+		ttl = p.Max
+	}
+	return ttl
+}
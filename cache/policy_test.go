@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := &Policy{
+		Min:    time.Minute,
+		Max:    time.Hour,
+		Jitter: 0.5,
+		Providers: map[string]time.Duration{
+			"local":    24 * time.Hour,
+			"realtime": time.Second,
+		},
+	}
+	cases := []struct {
+		Provider string
+		Random   float64
+		TTL      time.Duration
+	}{
+		{Provider: "", Random: 0.5, TTL: 4 * time.Minute},
+		{Provider: "", Random: 0, TTL: 2 * time.Minute},
+		{Provider: "", Random: 0.75, TTL: 5 * time.Minute},
+		{Provider: "local", Random: 0.5, TTL: time.Hour},
+		{Provider: "realtime", Random: 0.5, TTL: time.Minute},
+	}
+	for i, testCase := range cases {
+		if ttl := policy.ttl(TTL, Origin{Provider: testCase.Provider}, testCase.Random); ttl != testCase.TTL {
+			t.Fatalf("Case [%v]: invalid ttl: expected: %v, but %v", i, testCase.TTL, ttl)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if ttl := policy.TTL(TTL, Origin{}); ttl < 2*time.Minute || 6*time.Minute < ttl {
+			t.Fatalf("TTL out of jitter bounds: %v", ttl)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// RefreshFunc returns new value for key & its origin or false, if value can't be refreshed now
+type RefreshFunc[K comparable, V any] func(key K) (V, Origin, bool)
+
+// hot entry of cache
+type hot[K comparable] struct {
+	key  K
+	last int64
+}
+
+// Refresher - goroutine, which refreshes hot entries before their deadline.
+// Entry is hot if it has been accessed during the last period
+// and its deadline comes in less than ahead.
+func Refresher[K comparable, V any](ctx context.Context, cache *Cache[K, V], period, ahead time.Duration, refresh RefreshFunc[K, V]) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(period):
+		}
+
+		refreshHot(cache, time.Now(), period, ahead, refresh)
+	}
+}
+
+// refreshHot returns number of refreshed entries
+func refreshHot[K comparable, V any](cache *Cache[K, V], now time.Time, period, ahead time.Duration, refresh RefreshFunc[K, V]) (n int) {
+	since, until := now.Add(-period).UnixNano(), now.Add(ahead).UnixNano()
+
+	var entries []hot[K]
+	cache.Range(func(key K, entry *Entry[V]) bool {
+		deadline, last := entry.Deadline(), entry.Last()
+		if now.UnixNano() <= deadline && deadline <= until && since <= last {
+			entries = append(entries, hot[K]{key: key, last: last})
+		}
+		return true
+	})
+
+	for _, entry := range entries {
+		value, origin, ok := refresh(entry.key)
+		if !ok {
+			continue
+		}
+
+		// keep time of last data access, otherwise entry stays hot forever
+		cache.insert(entry.key, &Entry[V]{
+			val:      value,
+			origin:   origin,
+			inserted: now.UnixNano(),
+			last:     entry.last,
+			deadline: now.Add(cache.TTL(origin)).UnixNano(),
+		})
+		n++
+	}
+	return
+}
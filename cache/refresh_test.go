@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshHot(t *testing.T) {
+	t.Parallel()
+
+	const (
+		period = time.Minute
+		ahead  = time.Minute
+	)
+
+	start := time.Unix(1000, 0)
+	now := start.Add(TTL - ahead/2)
+
+	c := NewCache(4, TTL)
+	c.insert("hot", &Entry[ValueType]{val: "old", last: now.Add(-period / 2).UnixNano(), deadline: start.Add(TTL).UnixNano()})
+	c.insert("cold", &Entry[ValueType]{val: "old", last: now.Add(-2 * period).UnixNano(), deadline: start.Add(TTL).UnixNano()})
+	c.insert("fresh", &Entry[ValueType]{val: "old", last: now.UnixNano(), deadline: now.Add(TTL).UnixNano()})
+	c.insert("failed", &Entry[ValueType]{val: "old", last: now.Add(-period / 2).UnixNano(), deadline: start.Add(TTL).UnixNano()})
+
+	refreshed := map[string]int{}
+	n := refreshHot(c, now, period, ahead, func(key string) (ValueType, Origin, bool) {
+		refreshed[key]++
+		return "new", Origin{Provider: "provider"}, key != "failed"
+	})
+	if n != 1 {
+		t.Fatalf("Invalid number of refreshed entries: expected: 1, but %v (%v)", n, refreshed)
+	}
+	if len(refreshed) != 2 || refreshed["hot"] != 1 || refreshed["failed"] != 1 {
+		t.Fatalf("Invalid refreshed keys: expected: hot & failed, but %v", refreshed)
+	}
+
+	cases := []struct {
+		Key   string
+		Value ValueType
+	}{
+		{Key: "hot", Value: "new"},
+		{Key: "cold", Value: "old"},
+		{Key: "fresh", Value: "old"},
+	}
+	c.Range(func(key string, entry *Entry[ValueType]) bool {
+		for _, testCase := range cases {
+			if testCase.Key == key && entry.Value() != testCase.Value {
+				t.Fatalf("Key `%s`: expected: %v, but %v", key, testCase.Value, entry.Value())
+			}
+		}
+		if key == "hot" && entry.Last() != now.Add(-period/2).UnixNano() {
+			t.Fatalf("Refresh of `%s` changes time of last data access", key)
+		}
+		if key == "hot" && entry.Origin().Provider != "provider" {
+			t.Fatalf("Refresh of `%s` doesn't update origin: %v", key, entry.Origin())
+		}
+		return true
+	})
+}
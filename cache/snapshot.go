@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// snapshot formats
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+var (
+	// ErrFormat ...
+	ErrFormat = errors.New("Unknown snapshot format")
+
+	csvHeader = []string{"key", "value", "deadline", "provider", "fetched", "latency"}
+)
+
+// Record - snapshot record of cache entry
+type Record struct {
+	Key      string        `json:"key"`
+	Value    string        `json:"value"`
+	Deadline time.Time     `json:"deadline"`
+	Provider string        `json:"provider,omitempty"`
+	Fetched  time.Time     `json:"fetched"`
+	Latency  time.Duration `json:"latency"` // in nanoseconds
+}
+
+func newRecord[K, V ~string](key K, entry *Entry[V]) *Record {
+	origin := entry.Origin()
+	record := &Record{
+		Key:      string(key),
+		Value:    string(entry.Value()),
+		Deadline: time.Unix(0, entry.Deadline()),
+		Provider: origin.Provider,
+		Latency:  origin.Latency,
+	}
+	if origin.Fetched != 0 {
+		record.Fetched = time.Unix(0, origin.Fetched)
+	}
+	return record
+}
+
+func recordEntry[V ~string](r *Record, now int64) *Entry[V] {
+	origin := Origin{Provider: r.Provider, Latency: r.Latency}
+	if !r.Fetched.IsZero() {
+		origin.Fetched = r.Fetched.UnixNano()
+	}
+	return &Entry[V]{
+		val:      V(r.Value),
+		origin:   origin,
+		inserted: now,
+		last:     0, // imported entry hasn't been accessed yet, so it isn't hot for refresher
+		deadline: r.Deadline.UnixNano(),
+	}
+}
+
+func (r *Record) csv() []string {
+	var fetched string
+	if !r.Fetched.IsZero() {
+		fetched = r.Fetched.Format(time.RFC3339Nano)
+	}
+	return []string{
+		r.Key, r.Value, r.Deadline.Format(time.RFC3339Nano),
+		r.Provider, fetched, strconv.FormatInt(int64(r.Latency), 10),
+	}
+}
+
+// parseCSV parses csv record, origin fields are optional
+func (r *Record) parseCSV(fields []string) (err error) {
+	if len(fields) != 3 && len(fields) != len(csvHeader) {
+		return errors.New("Invalid csv record: wrong number of fields")
+	}
+	r.Key, r.Value = fields[0], fields[1]
+	if r.Deadline, err = time.Parse(time.RFC3339Nano, fields[2]); err != nil || len(fields) == 3 {
+		return
+	}
+
+	r.Provider = fields[3]
+	if fields[4] != "" {
+		if r.Fetched, err = time.Parse(time.RFC3339Nano, fields[4]); err != nil {
+			return
+		}
+	}
+	latency, err := strconv.ParseInt(fields[5], 10, 64)
+	r.Latency = time.Duration(latency)
+	return
+}
+
+// Export writes all live entries of cache to w, returns number of exported entries
+func Export[K, V ~string](c *Cache[K, V], w io.Writer, format string) (n int, err error) {
+	var (
+		write func(r *Record) error
+		flush func() error
+	)
+	switch format {
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buf)
+		write = func(r *Record) error { return encoder.Encode(r) }
+		flush = buf.Flush
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return 0, err
+		}
+		write = func(r *Record) error { return writer.Write(r.csv()) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		return 0, ErrFormat
+	}
+
+	now := time.Now().UnixNano()
+	c.Range(func(key K, entry *Entry[V]) bool {
+		deadline := entry.Deadline()
+		if now > deadline {
+			return true
+		}
+
+		if err = write(newRecord(key, entry)); err != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// Import loads entries from r into cache (expired entries are skipped, deadlines are limited
+// by TTL policy of cache),
+// returns number of imported entries
+func Import[K, V ~string](c *Cache[K, V], r io.Reader, format string) (n int, err error) {
+	var read func(r *Record) error
+	switch format {
+	case FormatNDJSON:
+		decoder := json.NewDecoder(r)
+		read = func(r *Record) error { return decoder.Decode(r) }
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		header := true
+		read = func(r *Record) error {
+			fields, err := reader.Read()
+			if err != nil {
+				return err
+			}
+			if header {
+				if header = false; fields[0] == csvHeader[0] {
+					if fields, err = reader.Read(); err != nil {
+						return err
+					}
+				}
+			}
+			return r.parseCSV(fields)
+		}
+	default:
+		return 0, ErrFormat
+	}
+
+	for {
+		var record Record
+		if err := read(&record); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+
+		now, deadline := time.Now().UnixNano(), record.Deadline.UnixNano()
+		if now > deadline {
+			continue
+		}
+		entry := recordEntry[V](&record, now)
+		if limit := now + int64(c.policy.Limit(c.ttl, entry.origin)); entry.deadline > limit {
+			entry.deadline = limit
+		}
+		c.insert(K(record.Key), entry)
+		n++
+	}
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	origin := Origin{Provider: "p", Fetched: time.Now().UnixNano(), Latency: time.Millisecond}
+	for _, format := range []string{FormatNDJSON, FormatCSV} {
+		src := NewCache(4, TTL)
+		src.Insert("zero", "0")
+		src.InsertFrom("one", "1", origin)
+		src.insert("expired", &Entry[ValueType]{val: "2", deadline: time.Now().Add(-time.Second).UnixNano()})
+
+		buf := &bytes.Buffer{}
+		if n, err := Export(src, buf, format); err != nil || n != 2 {
+			t.Fatalf("Export [%v]: expected 2 entries, but %v err: %v", format, n, err)
+		}
+
+		dst := NewCache(8, TTL)
+		if n, err := Import(dst, buf, format); err != nil || n != 2 {
+			t.Fatalf("Import [%v]: expected 2 entries, but %v err: %v", format, n, err)
+		}
+		for key, expected := range map[string]ValueType{"zero": "0", "one": "1"} {
+			if value, ok := dst.Get(key); !ok || value != expected {
+				t.Fatalf("Import [%v]: Get `%s` failed: expected: %v, but %v %v", format, key, expected, value, ok)
+			}
+		}
+		if entry, ok := dst.Peek("one"); !ok || entry.Origin() != origin {
+			t.Fatalf("Import [%v]: origin of `one` is lost: %v %v", format, entry, ok)
+		}
+		if value, ok := dst.Get("expired"); ok {
+			t.Fatalf("Import [%v]: key `expired` must be skipped, but returns %v %v", format, value, ok)
+		}
+	}
+}
+
+func TestSnapshotImportSkipsExpired(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Format string
+		Body   string
+	}{
+		{
+			Format: FormatNDJSON,
+			Body: `{"key":"old","value":"0","deadline":"2001-01-01T00:00:00Z"}
+{"key":"new","value":"1","deadline":"2201-01-01T00:00:00Z"}
+`,
+		},
+		{
+			Format: FormatCSV,
+			Body:   "key,value,deadline\nold,0,2001-01-01T00:00:00Z\nnew,1,2201-01-01T00:00:00Z\n",
+		},
+		{
+			Format: FormatCSV,
+			Body:   "old,0,2001-01-01T00:00:00Z\nnew,1,2201-01-01T00:00:00Z\n",
+		},
+	}
+	for i, testCase := range cases {
+		c := NewCache(4, TTL)
+		if n, err := Import(c, strings.NewReader(testCase.Body), testCase.Format); err != nil || n != 1 {
+			t.Fatalf("Case [%v]: expected 1 entry, but %v err: %v", i, n, err)
+		}
+		entry, ok := c.Peek("new")
+		if !ok || entry.Value() != "1" {
+			t.Fatalf("Case [%v]: Get `new` failed: expected: 1, but %v %v", i, entry, ok)
+		}
+		if limit := time.Now().Add(TTL).UnixNano(); entry.Deadline() > limit {
+			t.Fatalf("Case [%v]: deadline of `new` must be limited by TTL, but %v", i, time.Unix(0, entry.Deadline()))
+		}
+		if entry.Last() != 0 {
+			t.Fatalf("Case [%v]: imported entry mustn't be accessed, but last is %v", i, entry.Last())
+		}
+		if value, ok := c.Get("old"); ok {
+			t.Fatalf("Case [%v]: key `old` must be skipped, but returns %v %v", i, value, ok)
+		}
+	}
+
+	// max TTL of policy limits deadlines
+	c := NewCacheWithPolicy(4, TTL, Policy{Max: time.Hour})
+	body := `{"key":"new","value":"1","deadline":"2201-01-01T00:00:00Z"}`
+	if n, err := Import(c, strings.NewReader(body), FormatNDJSON); err != nil || n != 1 {
+		t.Fatalf("Max TTL: expected 1 entry, but %v err: %v", n, err)
+	}
+	if entry, ok := c.Peek("new"); !ok || entry.Deadline() > time.Now().Add(time.Hour).UnixNano() ||
+		entry.Deadline() < time.Now().Add(time.Hour-time.Minute).UnixNano() {
+		t.Fatalf("Max TTL: deadline of `new` must be limited by max TTL, but %v %v", entry, ok)
+	}
+
+	if _, err := Import(NewCache(4, TTL), strings.NewReader(""), "xml"); err != ErrFormat {
+		t.Fatalf("Unknown format: expected err: %v, but %v", ErrFormat, err)
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	wheelTick  = time.Second
+	wheelSlots = 4096 // wheel revolution is ~68 minutes
+)
+
+// timer - expiry of entry of node in partition
+type timer[K comparable, V any] struct {
+	node      *node[K, V]
+	partition int   // index of partition
+	deadline  int64 // deadline of entry at insertion, timer is stale if it has changed
+	tick      int64 // number of tick, when entry expires
+}
+
+// stale returns true if entry of timer has been overwritten or deleted
+func (t *timer[K, V]) stale() bool {
+	return t.node.isRemoved() || t.node.value.Deadline() != t.deadline
+}
+
+// slot of timing wheel
+type slot[K comparable, V any] struct {
+	mu     sync.Mutex
+	timers []timer[K, V]
+}
+
+// wheel - hashed timing wheel: timer of entry, which expires in the t-th tick,
+// is kept by (t % nslots) slot, so cleaner visits only timers of expiring entries
+// (timers of entries with TTL longer than wheel revolution are visited once per revolution)
+type wheel[K comparable, V any] struct {
+	slots  []slot[K, V]
+	tick   int64 // in nanoseconds
+	cursor int64 // number of last processed tick
+}
+
+func newWheel[K comparable, V any](tick time.Duration, nslots int, now time.Time) *wheel[K, V] {
+	return &wheel[K, V]{
+		slots:  make([]slot[K, V], nslots),
+		tick:   int64(tick),
+		cursor: now.UnixNano()/int64(tick) - 1,
+	}
+}
+
+func (w *wheel[K, V]) slot(tick int64) *slot[K, V] {
+	return &w.slots[tick%int64(len(w.slots))]
+}
+
+// add registers expiry of entry of node in partition
+func (w *wheel[K, V]) add(partition int, n *node[K, V]) {
+	deadline := n.value.Deadline()
+	tick := deadline / w.tick
+
+	// deadline has passed already, so entry is expired during next tick
+	// (if cursor moves concurrently, entry waits one revolution, but it's invisible for Get)
+	if cursor := atomic.LoadInt64(&w.cursor); tick <= cursor {
+		tick = cursor + 1
+	}
+
+	s := w.slot(tick)
+	s.mu.Lock()
+	s.timers = append(s.timers, timer[K, V]{node: n, partition: partition, deadline: deadline, tick: tick})
+	s.mu.Unlock()
+}
+
+// advance processes all ticks, which have passed before now,
+// returns timers of expired entries (only one goroutine may call it)
+func (w *wheel[K, V]) advance(now int64) (expired []timer[K, V]) {
+	from, until := atomic.LoadInt64(&w.cursor)+1, now/w.tick-1
+	if nslots := int64(len(w.slots)); until-from >= nslots {
+		from = until - nslots + 1
+	}
+
+	for tick := from; tick <= until; tick++ {
+		s := w.slot(tick)
+
+		s.mu.Lock()
+		kept := s.timers[:0]
+		for _, t := range s.timers {
+			if t.tick <= tick {
+				expired = append(expired, t)
+			} else {
+				kept = append(kept, t)
+			}
+		}
+		for i := len(kept); i < len(s.timers); i++ {
+			s.timers[i] = timer[K, V]{}
+		}
+		s.timers = kept
+		s.mu.Unlock()
+	}
+
+	if from <= until {
+		atomic.StoreInt64(&w.cursor, until)
+	}
+	return expired
+}
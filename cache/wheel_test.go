@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestWheel(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	w := newWheel[string, ValueType](time.Second, 8, start)
+
+	newNode := func(key string, deadline time.Time) *node[string, ValueType] {
+		return &node[string, ValueType]{key: key, value: &Entry[ValueType]{deadline: deadline.UnixNano()}}
+	}
+	w.add(0, newNode("soon", start.Add(2500*time.Millisecond)))
+	w.add(1, newNode("late", start.Add(20*time.Second))) // longer than wheel revolution
+	w.add(2, newNode("passed", start.Add(-time.Minute)))
+
+	cases := []struct {
+		Now     time.Duration
+		Expired []string
+	}{
+		{Now: 0, Expired: nil},
+		{Now: time.Second, Expired: []string{"passed"}},
+		{Now: 3 * time.Second, Expired: []string{"soon"}},
+		{Now: 12 * time.Second, Expired: nil},
+		{Now: 21 * time.Second, Expired: []string{"late"}},
+		{Now: time.Minute, Expired: nil},
+	}
+	for i, testCase := range cases {
+		expired := w.advance(start.Add(testCase.Now).UnixNano())
+		if len(expired) != len(testCase.Expired) {
+			t.Fatalf("Case [%v]: expected %v expired timers, but %v", i, len(testCase.Expired), len(expired))
+		}
+		for j, key := range testCase.Expired {
+			if expired[j].node.key != key {
+				t.Fatalf("Case [%v]: entry %v must be expired, but %v", i, key, expired[j].node.key)
+			}
+		}
+	}
+}
+
+func TestCacheExpire(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	c := NewCache(1, TTL)
+	c.wheel = newWheel[string, ValueType](time.Second, 8, start)
+
+	for i := 0; i < 16; i++ {
+		deadline := start.Add(time.Duration(i%2+1) * TTL).UnixNano()
+		c.insert(strconv.Itoa(i), &Entry[ValueType]{val: "value", deadline: deadline})
+	}
+	// timers of overwritten & deleted entries are stale
+	c.insert("0", &Entry[ValueType]{val: "value", deadline: start.Add(3 * TTL).UnixNano()})
+	c.Delete("2")
+
+	// 6 of 15 entries have expired, it's less than half of partition, so there is no compaction
+	if n := c.expire(start.Add(TTL + time.Second).UnixNano()); n != 0 {
+		t.Fatalf("Invalid number of expired entries: expected: 0, but %v", n)
+	}
+	if length := atomic.LoadInt64(&c.partitions[0].length); length != 15 {
+		t.Fatalf("Invalid length of partition: expected: 15, but %v", length)
+	}
+
+	// half of entries have expired, so partition is compacted by one walk
+	if n := c.expire(start.Add(2*TTL + time.Second).UnixNano()); n != 14 {
+		t.Fatalf("Invalid number of expired entries: expected: 14, but %v", n)
+	}
+	if length := atomic.LoadInt64(&c.partitions[0].length); length != 1 {
+		t.Fatalf("Invalid length of partition: expected: 1, but %v", length)
+	}
+	if head := c.partitions[0].Head(); head == nil || head.key != "0" || head.Next() != nil {
+		t.Fatal("Expire doesn't delete all expired entries")
+	}
+}
+
+const (
+	benchPartitions = 256  // npartitions of conf.json
+	benchTicks      = 1024 // deadlines of entries are spread over ticks
+)
+
+// benchEntries - sizes of cache up to production ones
+var benchEntries = []int{1 << 18, 1 << 21, 1 << 22}
+
+// benchmarkExpire measures cost of one tick of expiry by sizes of cache
+func benchmarkExpire(b *testing.B, expire func(c *Cache[string, ValueType], now int64) int) {
+	for _, entries := range benchEntries {
+		entries := entries
+		b.Run(strconv.Itoa(entries), func(b *testing.B) {
+			benchmarkExpireEntries(b, entries, expire)
+		})
+	}
+}
+
+func benchmarkExpireEntries(b *testing.B, entries int, expire func(c *Cache[string, ValueType], now int64) int) {
+	start := time.Unix(1000, 0)
+	fill := func() *Cache[string, ValueType] {
+		c := NewCache(benchPartitions, TTL)
+		c.wheel = newWheel[string, ValueType](time.Second, wheelSlots, start)
+		for i := 0; i < entries; i++ {
+			key, deadline := strconv.Itoa(i), start.Add(time.Duration(i%benchTicks)*time.Second).UnixNano()
+			// keys are unique, so nodes are pushed without search of old ones by Insert
+			index := c.index(key)
+			partition := &c.partitions[index]
+			n := &node[string, ValueType]{key: key, value: &Entry[ValueType]{val: "value", deadline: deadline}}
+			n.next, partition.head = partition.head, unsafe.Pointer(n)
+			partition.length++
+			c.wheel.add(index, n)
+		}
+		return c
+	}
+
+	c := fill()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tick := i % benchTicks
+		if i > 0 && tick == 0 {
+			b.StopTimer()
+			c = fill()
+			b.StartTimer()
+		}
+		expire(c, start.Add(time.Duration(tick+1)*time.Second).UnixNano())
+	}
+}
+
+func BenchmarkExpireWheel(b *testing.B) {
+	benchmarkExpire(b, func(c *Cache[string, ValueType], now int64) int {
+		return c.expire(now)
+	})
+}
+
+// BenchmarkExpireScan - previous Cleaner, which walks every node of every partition
+func BenchmarkExpireScan(b *testing.B) {
+	benchmarkExpire(b, func(c *Cache[string, ValueType], now int64) (n int) {
+		for i := range c.partitions {
+			n += c.partitions[i].removeExpired(now)
+		}
+		return
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/searchinform/cache"
+)
+
+const cacheUsage = "usage: searchinform cache export|import [-addr URL] [-token TOKEN] [-format ndjson|csv] [-f FILE]"
+
+// formatByPath returns snapshot format by file extension
+func formatByPath(path string) string {
+	if filepath.Ext(path) == ".csv" {
+		return cache.FormatCSV
+	}
+	return cache.FormatNDJSON
+}
+
+// loadSnapshot imports snapshot file into cache of starting instance
+func loadSnapshot(c *cache.Cache[string, string], path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return cache.Import(c, file, formatByPath(path))
+}
+
+// cacheCommand runs `cache export` & `cache import` subcommands against running instance
+func cacheCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(cacheUsage)
+	}
+
+	flags := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	addr := flags.String("addr", "http://127.0.0.1:8080", "server address")
+	token := flags.String("token", os.Getenv("SEARCHINFORM_ADMIN_TOKEN"), "admin API token")
+	format := flags.String("format", "", "snapshot format: ndjson or csv (by file extension if empty)")
+	path := flags.String("f", "", "snapshot filepath (stdout for export, stdin for import if empty)")
+	flags.Parse(args[1:])
+
+	if *format == "" {
+		*format = formatByPath(*path)
+	}
+	query := url.Values{"format": {*format}}.Encode()
+
+	switch args[0] {
+	case "export":
+		return exportCommand(*addr+"/admin/cache/export?"+query, *token, *path)
+	case "import":
+		return importCommand(*addr+"/admin/cache/import?"+query, *token, *path)
+	}
+	return errors.New(cacheUsage)
+}
+
+func adminDo(req *http.Request, token string) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		msg, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, errors.New("Invalid status code: " + resp.Status + ": " + string(msg))
+	}
+	return resp, nil
+}
+
+func exportCommand(target, token, path string) error {
+	out := os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := adminDo(req, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+func importCommand(target, token, path string) error {
+	in := os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, in)
+	if err != nil {
+		return err
+	}
+	resp, err := adminDo(req, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(os.Stderr, resp.Body)
+	return err
+}
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"net/http"
 
 	"github.com/searchinform/provider"
@@ -10,35 +9,60 @@ import (
 
 // HTTPClient - custom http client
 type HTTPClient struct {
-	client http.Client
+	client    http.Client
+	providers map[string]*http.Client // clients of providers with own settings by name
 }
 
 // NewHTTPClient - constuctor for HTTPClient struct
-func NewHTTPClient(client *http.Client, providers *provider.Iterator) *HTTPClient {
+func NewHTTPClient(client *http.Client, providers map[string]*http.Client) *HTTPClient {
 	return &HTTPClient{
-		client: *client,
+		client:    *client,
+		providers: providers,
 	}
 }
 
-// Resolve returns country of this addr
-func (c *HTTPClient) Resolve(provider *provider.Provider, addr string) (country string, err error) {
-	url := fmt.Sprintf(provider.URLPattern, addr)
-	req, err := http.NewRequest(provider.Method, url, nil)
+// clientOf returns http client of provider
+func (c *HTTPClient) clientOf(p *provider.Provider) *http.Client {
+	if client, ok := c.providers[p.Name]; ok {
+		return client
+	}
+	return &c.client
+}
+
+// Resolve returns country of this addr, request is cancelled with ctx
+func (c *HTTPClient) Resolve(ctx context.Context, p *provider.Provider, addr string) (country string, err error) {
+	req, err := p.NewRequest(ctx, addr)
 	if err != nil {
 		return "", err
 	}
-	for key, value := range provider.Headers {
-		req.Header.Set(key, value)
-	}
 
-	resp, err := c.client.Do(req)
+	resp, err := c.clientOf(p).Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
-		return "", errors.New("Invalid status code:" + resp.Status)
+		return "", &provider.StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	return p.ParseBody(resp.Body)
+}
+
+// ResolveBatch returns answers about addrs (in the same order) by one batch call
+func (c *HTTPClient) ResolveBatch(ctx context.Context, p *provider.Provider, addrs []string) ([]provider.Answer, error) {
+	req, err := p.NewBatchRequest(ctx, addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.clientOf(p).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return nil, &provider.StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 
-	return provider.ParseBody(resp.Body)
+	return p.ParseBatch(resp.Body, addrs)
 }
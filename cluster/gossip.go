@@ -0,0 +1,163 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/searchinform/provider"
+)
+
+// Header marks requests between peers, its value is shared secret
+const Header = "X-Searchinform-Peer"
+
+// maxMessageSize - limit of gossip message body
+const maxMessageSize = 1 << 20
+
+// Gossip - exchange of provider request counts between peers,
+// it implements provider.Shared
+type Gossip struct {
+	self   string
+	peers  []string
+	secret string
+	client *http.Client
+	logger *log.Logger
+
+	mu     sync.RWMutex
+	remote map[string]*provider.History // by peer
+}
+
+// NewGossip - constructor for Gossip struct
+func NewGossip(self string, peers []string, secret string, client *http.Client, logger *log.Logger) *Gossip {
+	return &Gossip{
+		self:   self,
+		peers:  peers,
+		secret: secret,
+		client: client,
+		logger: logger,
+		remote: make(map[string]*provider.History, len(peers)),
+	}
+}
+
+// Rate returns number of requests of other peers to provider for the last minute
+func (g *Gossip) Rate(name string, now int64) (sum int64) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for _, history := range g.remote {
+		sum += history.Rate(name, now)
+	}
+	return
+}
+
+// Receive stores request counts of peer
+func (g *Gossip) Receive(peer string, history *provider.History) error {
+	if peer == g.self {
+		return errors.New("Gossip: peer `" + peer + "` is this replica")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.remote[peer]; !ok && !g.known(peer) {
+		return errors.New("Gossip: unknown peer `" + peer + "`")
+	}
+	g.remote[peer] = history
+	return nil
+}
+
+func (g *Gossip) known(peer string) bool {
+	for _, p := range g.peers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
+
+// message - gossip message
+type message struct {
+	Peer    string            `json:"peer"`
+	History *provider.History `json:"history"`
+}
+
+// Decode decodes gossip message and stores it, body of request is limited by maxMessageSize
+func (g *Gossip) Decode(w http.ResponseWriter, r *http.Request) error {
+	secret, ok := r.Header[http.CanonicalHeaderKey(Header)]
+	if g.secret == "" || !ok || len(secret) != 1 || subtle.ConstantTimeCompare([]byte(secret[0]), []byte(g.secret)) != 1 {
+		return errors.New("Gossip: invalid secret")
+	}
+
+	var msg message
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize)).Decode(&msg); err != nil {
+		return err
+	}
+	if msg.History == nil {
+		return errors.New("Gossip: empty history")
+	}
+	return g.Receive(msg.Peer, msg.History)
+}
+
+func (g *Gossip) send(ctx context.Context, peer string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+"/internal/rates", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(Header, g.secret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return errors.New("Invalid status code:" + resp.Status)
+	}
+	return nil
+}
+
+// broadcast sends history to all other peers
+func (g *Gossip) broadcast(ctx context.Context, history *provider.History) {
+	body, err := json.Marshal(&message{Peer: g.self, History: history})
+	if err != nil {
+		g.logger.Println("Gossip: marshal err :", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, peer := range g.peers {
+		if peer == g.self {
+			continue
+		}
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			if err := g.send(ctx, peer, body); err != nil {
+				g.logger.Printf("Gossip: peer [%v]: err : %v", peer, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// Run - goroutine, which sends local request counts to all peers every period
+func (g *Gossip) Run(ctx context.Context, period time.Duration, local func(now int64) *provider.History) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			g.broadcast(ctx, local(now.Unix()))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/searchinform/provider"
+)
+
+func TestGossip(t *testing.T) {
+	t.Parallel()
+
+	logger := log.New(io.Discard, "", 0)
+
+	var receiver *Gossip
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := receiver.Decode(w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	const sender = "http://sender"
+	receiver = NewGossip(server.URL, []string{sender, server.URL}, "secret", server.Client(), logger)
+
+	history := &provider.History{Since: 100, Counts: map[string][]int64{"a": {1, 2}}}
+	NewGossip(sender, []string{sender, server.URL}, "secret", server.Client(), logger).
+		broadcast(context.Background(), history)
+
+	if rate := receiver.Rate("a", 101); rate != 3 {
+		t.Fatalf("Invalid rate: expected: 3, but %v", rate)
+	}
+
+	// wrong secret & unknown peer
+	NewGossip(sender, []string{sender, server.URL}, "wrong", server.Client(), logger).
+		broadcast(context.Background(), &provider.History{Since: 100, Counts: map[string][]int64{"a": {8}}})
+	NewGossip("http://unknown", []string{"http://unknown", server.URL}, "secret", server.Client(), logger).
+		broadcast(context.Background(), &provider.History{Since: 100, Counts: map[string][]int64{"a": {8}}})
+
+	if rate := receiver.Rate("a", 101); rate != 3 {
+		t.Fatalf("Invalid rate after rejected messages: expected: 3, but %v", rate)
+	}
+
+	// too large message
+	body := append([]byte(`{"peer":"`+sender+`","history":{"since":100,"counts":{"a":[`), bytes.Repeat([]byte("1,"), maxMessageSize)...)
+	body = append(body, []byte(`1]}}}`)...)
+	if err := NewGossip(sender, []string{sender, server.URL}, "secret", server.Client(), logger).
+		send(context.Background(), server.URL, body); err == nil {
+		t.Fatal("Too large message must be rejected")
+	}
+	if rate := receiver.Rate("a", 101); rate != 3 {
+		t.Fatalf("Invalid rate after too large message: expected: 3, but %v", rate)
+	}
+}
+
+func TestGossipEmptySecret(t *testing.T) {
+	t.Parallel()
+
+	receiver := NewGossip("http://receiver", []string{"http://sender", "http://receiver"}, "", nil, log.New(io.Discard, "", 0))
+	req := httptest.NewRequest(http.MethodPost, "/internal/rates", bytes.NewReader([]byte(`{"peer":"http://sender","history":{"since":100,"counts":{"a":[1]}}}`)))
+	req.Header.Set(Header, "")
+	if err := receiver.Decode(httptest.NewRecorder(), req); err == nil {
+		t.Fatal("Message must be rejected if secret isn't set")
+	}
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// vnode - virtual node of ring
+type vnode struct {
+	hash uint32
+	node string
+}
+
+// Ring - consistent-hash ring, each node has replicas virtual nodes on the ring
+type Ring struct {
+	vnodes []vnode // sorted by hash
+}
+
+// NewRing - constructor for Ring struct
+func NewRing(nodes []string, replicas int) *Ring {
+	vnodes := make([]vnode, 0, len(nodes)*replicas)
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(i)))
+			vnodes = append(vnodes, vnode{hash: hash, node: node})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool {
+		if vnodes[i].hash == vnodes[j].hash {
+			return vnodes[i].node < vnodes[j].node
+		}
+		return vnodes[i].hash < vnodes[j].hash
+	})
+	return &Ring{vnodes: vnodes}
+}
+
+// Owner returns owner node of key (empty if ring is empty)
+func (r *Ring) Owner(key string) string {
+	if len(r.vnodes) == 0 {
+		return ""
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	index := sort.Search(len(r.vnodes), func(i int) bool { return r.vnodes[i].hash >= hash })
+	if index == len(r.vnodes) {
+		index = 0
+	}
+	return r.vnodes[index].node
+}
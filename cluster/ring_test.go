@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRingOwner(t *testing.T) {
+	t.Parallel()
+
+	nodes := []string{"http://node0", "http://node1", "http://node2"}
+	ring := NewRing(nodes, 64)
+
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+		owner := ring.Owner(key)
+		if owner != ring.Owner(key) {
+			t.Fatalf("Owner of `%s` isn't stable", key)
+		}
+		counts[owner]++
+	}
+
+	for _, node := range nodes {
+		if counts[node] < 500 {
+			t.Fatalf("Keys are distributed unevenly: %v", counts)
+		}
+	}
+
+	if owner := NewRing(nil, 64).Owner("key"); owner != "" {
+		t.Fatalf("Empty ring returns owner `%s`", owner)
+	}
+}
+
+func TestRingRemoveNode(t *testing.T) {
+	t.Parallel()
+
+	full := NewRing([]string{"http://node0", "http://node1", "http://node2"}, 64)
+	reduced := NewRing([]string{"http://node0", "http://node1"}, 64)
+
+	for i := 0; i < 1000; i++ {
+		key := "192.168.0." + strconv.Itoa(i)
+		// only keys of removed node move to other nodes
+		if owner := full.Owner(key); owner != "http://node2" && reduced.Owner(key) != owner {
+			t.Fatalf("Key `%s` has moved from %v to %v", key, owner, reduced.Owner(key))
+		}
+	}
+}
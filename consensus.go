@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/searchinform/cache"
+	"github.com/searchinform/provider"
+)
+
+// Vote - answer of one provider in consensus
+type Vote struct {
+	Provider string   `json:"provider"`
+	Country  string   `json:"country,omitempty"`
+	Latency  Duration `json:"latency"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Consensus - majority answer of several providers
+type Consensus struct {
+	Country    string  `json:"country"`
+	Confidence float64 `json:"confidence"` // share of queried providers, which answered country
+	Votes      []Vote  `json:"answers"`
+}
+
+// vote returns majority country of votes (ties are broken by order of countries)
+func vote(votes []Vote) *Consensus {
+	counts := make(map[string]int, len(votes))
+	for _, v := range votes {
+		if v.Error == "" {
+			counts[v.Country]++
+		}
+	}
+
+	countries := make([]string, 0, len(counts))
+	for country := range counts {
+		countries = append(countries, country)
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		if counts[countries[i]] != counts[countries[j]] {
+			return counts[countries[i]] > counts[countries[j]]
+		}
+		return countries[i] < countries[j]
+	})
+
+	consensus := &Consensus{Votes: votes}
+	if len(countries) > 0 {
+		consensus.Country = countries[0]
+		consensus.Confidence = float64(counts[countries[0]]) / float64(len(votes))
+	}
+	return consensus
+}
+
+// consensus returns majority country of addr by n distinct providers queried in parallel,
+// n is limited by number of providers
+func (ctrl *Controller) consensus(ctx context.Context, host, addr string, n int) (*Consensus, bool, error) {
+	if total := ctrl.providers.Len(); n > total {
+		n = total
+	}
+
+	// cached consensus of fewer providers is not enough
+	if entry, ok := ctrl.consensuses.Lookup(addr); ok && len(entry.Value().Votes) >= n {
+		consensus := entry.Value()
+		ctrl.logger.Printf("Resolve [%v]: addr [%v]: consensus cache hit: country is `%v` (confidence %v)",
+			host, addr, consensus.Country, consensus.Confidence)
+		return &consensus, true, nil
+	}
+
+	// client, which has gone, doesn't consume quota of providers
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	providers := make([]*provider.Provider, 0, n)
+	for len(providers) < n {
+		p, err := ctrl.providers.NextExcept(providers...)
+		if err != nil {
+			break
+		}
+		providers = append(providers, p)
+	}
+	if len(providers) == 0 {
+		return nil, false, errors.New("providers iter err : " + provider.ErrNotFound.Error())
+	}
+
+	votes := make([]Vote, len(providers))
+	done := make(chan struct{}, len(providers))
+	for i := range providers {
+		go func(i int) {
+			country, origin, err := ctrl.fetch(ctx, providers[i], addr)
+			votes[i] = Vote{Provider: providers[i].Name, Country: country, Latency: Duration{origin.Latency}}
+			if err != nil {
+				votes[i] = Vote{Provider: providers[i].Name, Latency: Duration{origin.Latency}, Error: err.Error()}
+			}
+			done <- struct{}{}
+		}(i)
+	}
+	for range providers {
+		<-done
+	}
+
+	consensus := vote(votes)
+	if consensus.Country == "" {
+		return nil, false, errors.New("http client err : all providers have failed")
+	}
+	ctrl.consensuses.InsertFrom(addr, *consensus, cache.Origin{})
+
+	ctrl.logger.Printf("Resolve [%v]: addr [%v]: consensus of %v providers: country `%v` (confidence %v)",
+		host, addr, len(votes), consensus.Country, consensus.Confidence)
+	return consensus, false, nil
+}
+
+// countryByConsensus writes majority country of host by n providers
+func (ctrl *Controller) countryByConsensus(w http.ResponseWriter, r *http.Request, host string, n int) {
+	ctx, cancel, err := requestContext(r)
+	if err != nil {
+		ctrl.error(w, "Resolve err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	addr, err := ctrl.lookup(ctx, host)
+	if err != nil {
+		ctrl.error(w, "Resolve err: host lookup err : "+err.Error(), errorCode(ctx))
+		return
+	}
+
+	consensus, cached, err := ctrl.consensus(ctx, host, addr, n)
+	if err != nil {
+		ctrl.error(w, "Resolve err: "+err.Error(), errorCode(ctx))
+		return
+	}
+
+	body := &struct {
+		Host     string `json:"host"`
+		Addr     string `json:"addr"`
+		Hostname string `json:"hostname,omitempty"`
+		*Consensus
+		Cached bool `json:"cached"`
+	}{Host: host, Addr: addr, Consensus: consensus, Cached: cached}
+
+	if rdns, _ := strconv.ParseBool(r.FormValue("rdns")); rdns {
+		body.Hostname = ctrl.hostname(ctx, addr)
+	}
+
+	json.NewEncoder(w).Encode(body)
+}
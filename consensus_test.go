@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVote(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Votes      []Vote
+		Country    string
+		Confidence float64
+	}{
+		{Votes: nil},
+		{Votes: []Vote{{Provider: "a", Error: "failure"}}},
+		{
+			Votes:      []Vote{{Provider: "a", Country: "X"}, {Provider: "b", Country: "Y"}, {Provider: "c", Country: "X"}},
+			Country:    "X",
+			Confidence: 2. / 3,
+		},
+		{
+			// tie is broken by order of countries, failed votes are counted in confidence
+			Votes:      []Vote{{Provider: "a", Country: "Y"}, {Provider: "b", Country: "X"}, {Provider: "c", Error: "failure"}, {Provider: "d", Country: "X", Error: "failure"}},
+			Country:    "X",
+			Confidence: 1. / 4,
+		},
+	}
+	for i, testCase := range cases {
+		consensus := vote(testCase.Votes)
+		if consensus.Country != testCase.Country || consensus.Confidence != testCase.Confidence || len(consensus.Votes) != len(testCase.Votes) {
+			t.Fatalf("Case [%v]: expected: %v (%v), but %+v", i, testCase.Country, testCase.Confidence, consensus)
+		}
+	}
+}
+
+func TestConsensus(t *testing.T) {
+	t.Parallel()
+
+	stubs := []*stub{newStub(t, "Firstland", 0), newStub(t, "Secondland", 0), newStub(t, "Firstland", 0)}
+	ctrl := newTestController(t, testConfig(stubs...))
+
+	// n is limited by number of providers
+	consensus, cached, err := ctrl.consensus(context.Background(), "host", "1.2.3.4", 1<<40)
+	if err != nil || cached || consensus.Country != "Firstland" || len(consensus.Votes) != len(stubs) {
+		t.Fatalf("Invalid consensus: %+v cached: %v err: %v", consensus, cached, err)
+	}
+	for i, s := range stubs {
+		if s.Requests() != 1 {
+			t.Fatalf("Provider [%v]: expected 1 request, but %v", i, s.Requests())
+		}
+	}
+
+	// cached consensus of all providers is enough for any n
+	for _, n := range []int{2, 3, 1 << 40} {
+		if consensus, cached, err := ctrl.consensus(context.Background(), "host", "1.2.3.4", n); err != nil || !cached || consensus.Country != "Firstland" {
+			t.Fatalf("N [%v]: invalid consensus: %+v cached: %v err: %v", n, consensus, cached, err)
+		}
+	}
+	if stubs[0].Requests() != 1 {
+		t.Fatalf("Cached consensus requests providers: %v requests", stubs[0].Requests())
+	}
+}
+
+func TestCountryByConsensus(t *testing.T) {
+	t.Parallel()
+
+	stubs := []*stub{newStub(t, "Firstland", 0), newStub(t, "Secondland", 0)}
+	ctrl := newTestController(t, testConfig(stubs...))
+
+	w := httptest.NewRecorder()
+	ctrl.CountryByIP(w, httptest.NewRequest(http.MethodGet, "/api/country?host=1.2.3.4&consensus=9999999999999", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Invalid status code: %v body: %v", w.Code, w.Body)
+	}
+
+	var body struct {
+		Addr    string `json:"addr"`
+		Country string `json:"country"`
+		Votes   []Vote `json:"answers"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal("Decode err:", err)
+	}
+	if body.Addr != "1.2.3.4" || body.Country != "Firstland" || len(body.Votes) != len(stubs) {
+		t.Fatalf("Invalid answer: %+v", body)
+	}
+}
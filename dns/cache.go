@@ -0,0 +1,154 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/searchinform/cache"
+)
+
+// answer - cached addrs of host or names of addr (negative answer if it's empty)
+type answer struct {
+	records []string
+}
+
+// Cache - resolver with cache of answers, TTLs of answers are respected within bounds
+type Cache struct {
+	resolver Resolver
+	cache    *cache.Cache[string, answer]
+
+	ttl      time.Duration // TTL of answers with unknown TTL (they aren't cached if zero)
+	negative time.Duration // TTL of negative answers with unknown TTL (they aren't cached if zero)
+	min, max time.Duration // bounds of known TTL, zero TTL is raised to min (max is disabled if zero)
+}
+
+// NewCache - constructor for Cache struct
+func NewCache(resolver Resolver, npartitions int, ttl, negative, min, max time.Duration) *Cache {
+	return &Cache{
+		resolver: resolver,
+		cache:    cache.New[string, answer](npartitions, ttl, cache.StringHasher, cache.Policy{}),
+		ttl:      ttl,
+		negative: negative,
+		min:      min,
+		max:      max,
+	}
+}
+
+// Run - goroutine, which removes expired answers
+func (c *Cache) Run(ctx context.Context) {
+	cache.Cleaner(ctx, c.cache)
+}
+
+// bound returns TTL within bounds (fallback is used if TTL is UnknownTTL)
+func (c *Cache) bound(ttl, fallback time.Duration) time.Duration {
+	if ttl < 0 {
+		return fallback
+	}
+	if ttl < c.min {
+		ttl = c.min
+	}
+	if c.max > 0 && ttl > c.max {
+		ttl = c.max
+	}
+	return ttl
+}
+
+// lookup returns records from cache by key or from resolver by fn with their remaining TTL
+// (zero if they aren't cached)
+func (c *Cache) lookup(ctx context.Context, key string,
+	fn func(ctx context.Context) ([]string, time.Duration, error)) ([]string, time.Duration, error) {
+
+	if entry, ok := c.cache.Lookup(key); ok {
+		ttl := time.Duration(entry.Deadline() - time.Now().UnixNano())
+		if ttl < 0 {
+			ttl = 0
+		}
+		if ans := entry.Value(); len(ans.records) > 0 {
+			return ans.records, ttl, nil
+		}
+		return nil, ttl, ErrNotFound
+	}
+
+	records, ttl, err := fn(ctx)
+	switch {
+	case err == ErrNotFound:
+		if ttl = c.bound(ttl, c.negative); ttl > 0 {
+			c.cache.InsertWithTTL(key, answer{}, cache.Origin{}, ttl)
+		}
+		return nil, ttl, err
+	case err != nil:
+		return nil, 0, err
+	case len(records) == 0:
+		return nil, 0, ErrNotFound
+	}
+
+	if ttl = c.bound(ttl, c.ttl); ttl > 0 {
+		c.cache.InsertWithTTL(key, answer{records: records}, cache.Origin{}, ttl)
+	}
+	return records, ttl, nil
+}
+
+// LookupHost returns addrs of host from cache or resolver
+func (c *Cache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	addrs, _, err := c.lookupHost(ctx, host)
+	return addrs, err
+}
+
+func (c *Cache) lookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	return c.lookup(ctx, strings.ToLower(Fqdn(host)), func(ctx context.Context) ([]string, time.Duration, error) {
+		return c.resolver.LookupHost(ctx, host)
+	})
+}
+
+// LookupAddr returns names of addr from cache or resolver
+func (c *Cache) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	names, _, err := c.lookupAddr(ctx, addr)
+	return names, err
+}
+
+func (c *Cache) lookupAddr(ctx context.Context, addr string) ([]string, time.Duration, error) {
+	name, err := ReverseName(addr) // key of PTR answers doesn't overlap with hosts
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return c.lookup(ctx, name, func(ctx context.Context) ([]string, time.Duration, error) {
+		return c.resolver.LookupAddr(ctx, addr)
+	})
+}
+
+// Hostname returns forward-confirmed name of addr (without trailing dot):
+// the first name of PTR records, which resolves back to addr, and TTL of result,
+// which is the least TTL of answers it depends on (zero if any of them isn't cached)
+func (c *Cache) Hostname(ctx context.Context, addr string) (string, time.Duration, error) {
+	names, ttl, err := c.lookupAddr(ctx, addr)
+	if err != nil {
+		return "", ttl, err
+	}
+
+	ip := net.ParseIP(addr)
+	for _, name := range names {
+		addrs, hostTTL, err := c.lookupHost(ctx, name)
+		if hostTTL < ttl {
+			ttl = hostTTL
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", 0, err
+			}
+			continue
+		}
+		for _, a := range addrs {
+			if ip.Equal(net.ParseIP(a)) {
+				return strings.TrimSuffix(name, "."), ttl, nil
+			}
+		}
+	}
+	return "", ttl, ErrNotConfirmed
+}
@@ -0,0 +1,220 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resolver - fake resolver, which counts lookups
+type resolver struct {
+	addrs   map[string][]string
+	names   map[string][]string // names of addrs
+	ttl     time.Duration
+	err     error
+	lookups int64
+}
+
+func (r *resolver) LookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	atomic.AddInt64(&r.lookups, 1)
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	addrs, ok := r.addrs[host]
+	if !ok {
+		return nil, r.ttl, ErrNotFound
+	}
+	return addrs, r.ttl, nil
+}
+
+func (r *resolver) LookupAddr(ctx context.Context, addr string) ([]string, time.Duration, error) {
+	atomic.AddInt64(&r.lookups, 1)
+	names, ok := r.names[addr]
+	if !ok {
+		return nil, r.ttl, ErrNotFound
+	}
+	return names, r.ttl, nil
+}
+
+func TestCacheLookupHost(t *testing.T) {
+	t.Parallel()
+
+	r := &resolver{addrs: map[string][]string{"example.com": {"1.2.3.4"}}, ttl: 50 * time.Millisecond}
+	c := NewCache(r, 4, time.Minute, time.Minute, 0, 0)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		addrs, err := c.LookupHost(ctx, "example.com")
+		if err != nil || !reflect.DeepEqual(addrs, []string{"1.2.3.4"}) {
+			t.Fatalf("Invalid answer: %v err: %v", addrs, err)
+		}
+		if _, err := c.LookupHost(ctx, "none.com"); err != ErrNotFound {
+			t.Fatalf("Must be err: %v, but %v", ErrNotFound, err)
+		}
+	}
+	// the same host in other case & fqdn
+	if _, err := c.LookupHost(ctx, "EXAMPLE.com."); err != nil {
+		t.Fatal("LookupHost err:", err)
+	}
+	if lookups := atomic.LoadInt64(&r.lookups); lookups != 2 {
+		t.Fatalf("Must be 2 lookups, but %v", lookups)
+	}
+
+	// TTL of answers is respected
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.LookupHost(ctx, "example.com"); err != nil {
+		t.Fatal("LookupHost err:", err)
+	}
+	if lookups := atomic.LoadInt64(&r.lookups); lookups != 3 {
+		t.Fatalf("Must be 3 lookups, but %v", lookups)
+	}
+
+	// IP literals aren't looked up
+	if addrs, err := c.LookupHost(ctx, "10.0.0.1"); err != nil || addrs[0] != "10.0.0.1" {
+		t.Fatalf("Invalid answer: %v err: %v", addrs, err)
+	}
+	if lookups := atomic.LoadInt64(&r.lookups); lookups != 3 {
+		t.Fatalf("Must be 3 lookups, but %v", lookups)
+	}
+}
+
+func TestCacheErrors(t *testing.T) {
+	t.Parallel()
+
+	r := &resolver{err: errors.New("timeout")}
+	c := NewCache(r, 4, time.Minute, time.Minute, 0, 0)
+	for i := 0; i < 2; i++ {
+		if _, err := c.LookupHost(context.Background(), "example.com"); err != r.err {
+			t.Fatalf("Must be err: %v, but %v", r.err, err)
+		}
+	}
+	// errors aren't cached
+	if lookups := atomic.LoadInt64(&r.lookups); lookups != 2 {
+		t.Fatalf("Must be 2 lookups, but %v", lookups)
+	}
+}
+
+func TestCacheBound(t *testing.T) {
+	t.Parallel()
+
+	c := NewCache(&resolver{}, 1, time.Minute, 5*time.Second, time.Second, time.Hour)
+	cases := []struct {
+		TTL, Fallback, Expected time.Duration
+	}{
+		{TTL: UnknownTTL, Fallback: time.Minute, Expected: time.Minute},
+		{TTL: 0, Fallback: time.Minute, Expected: time.Second},
+		{TTL: time.Millisecond, Fallback: time.Minute, Expected: time.Second},
+		{TTL: 10 * time.Minute, Fallback: time.Minute, Expected: 10 * time.Minute},
+		{TTL: 2 * time.Hour, Fallback: time.Minute, Expected: time.Hour},
+	}
+	for _, testCase := range cases {
+		if ttl := c.bound(testCase.TTL, testCase.Fallback); ttl != testCase.Expected {
+			t.Fatalf("TTL [%v]: must be %v, but %v", testCase.TTL, testCase.Expected, ttl)
+		}
+	}
+}
+
+func TestCacheZeroTTL(t *testing.T) {
+	t.Parallel()
+
+	// answer with zero TTL isn't cached without min TTL, fallback isn't used for it
+	cases := []struct {
+		Min     time.Duration
+		Lookups int64
+	}{
+		{Min: 0, Lookups: 2},
+		{Min: time.Minute, Lookups: 1},
+	}
+	for _, testCase := range cases {
+		r := &resolver{addrs: map[string][]string{"example.com": {"1.2.3.4"}}}
+		c := NewCache(r, 1, time.Hour, time.Hour, testCase.Min, 0)
+		for i := 0; i < 2; i++ {
+			if addrs, err := c.LookupHost(context.Background(), "example.com"); err != nil || len(addrs) != 1 {
+				t.Fatalf("Min [%v]: invalid answer: %v err: %v", testCase.Min, addrs, err)
+			}
+		}
+		if lookups := atomic.LoadInt64(&r.lookups); lookups != testCase.Lookups {
+			t.Fatalf("Min [%v]: must be %v lookups, but %v", testCase.Min, testCase.Lookups, lookups)
+		}
+	}
+}
+
+func TestCacheHostnameTTL(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		TTL, Fallback, Max time.Duration
+		Expected           time.Duration // TTL of the first answer
+	}{
+		{TTL: 30 * time.Second, Fallback: time.Hour, Expected: 30 * time.Second},
+		{TTL: time.Hour, Fallback: time.Second, Max: time.Minute, Expected: time.Minute},
+		{TTL: UnknownTTL, Fallback: 10 * time.Second, Expected: 10 * time.Second},
+		{TTL: UnknownTTL, Fallback: 0, Expected: 0}, // answers aren't cached
+	}
+	for i, testCase := range cases {
+		r := &resolver{
+			addrs: map[string][]string{"host.example.com.": {"10.0.0.1"}},
+			names: map[string][]string{"10.0.0.1": {"host.example.com."}},
+			ttl:   testCase.TTL,
+		}
+		c := NewCache(r, 1, testCase.Fallback, testCase.Fallback, 0, testCase.Max)
+
+		hostname, ttl, err := c.Hostname(context.Background(), "10.0.0.1")
+		if err != nil || hostname != "host.example.com" || ttl != testCase.Expected {
+			t.Fatalf("Case [%v]: expected: %v, actual: %v %v err: %v", i, testCase.Expected, hostname, ttl, err)
+		}
+		// remaining TTL of cached answers
+		if _, ttl, err := c.Hostname(context.Background(), "10.0.0.1"); err != nil || ttl > testCase.Expected ||
+			(testCase.Expected > 0 && ttl < testCase.Expected-time.Second) {
+			t.Fatalf("Case [%v]: cached: expected: %v, actual: %v err: %v", i, testCase.Expected, ttl, err)
+		}
+	}
+}
+
+func TestCacheHostname(t *testing.T) {
+	t.Parallel()
+
+	r := &resolver{
+		addrs: map[string][]string{
+			"host.example.com.":  {"10.0.0.1", "2001:db8::1"},
+			"other.example.com.": {"10.0.0.3"},
+		},
+		names: map[string][]string{
+			"10.0.0.1":             {"none.example.com.", "host.example.com."},
+			"2001:db8:0:0:0:0:0:1": {"host.example.com."},
+			"10.0.0.2":             {"other.example.com."}, // spoofed PTR
+		},
+		ttl: UnknownTTL,
+	}
+	c := NewCache(r, 4, time.Minute, time.Minute, 0, 0)
+
+	cases := []struct {
+		Addr     string
+		Hostname string
+		Err      error
+	}{
+		{Addr: "10.0.0.1", Hostname: "host.example.com"},
+		{Addr: "2001:db8:0:0:0:0:0:1", Hostname: "host.example.com"},
+		{Addr: "10.0.0.2", Err: ErrNotConfirmed},
+		{Addr: "10.0.0.4", Err: ErrNotFound},
+	}
+	for _, testCase := range cases {
+		hostname, _, err := c.Hostname(context.Background(), testCase.Addr)
+		if hostname != testCase.Hostname || err != testCase.Err {
+			t.Fatalf("Addr [%v]: expected: %v %v, actual: %v %v", testCase.Addr,
+				testCase.Hostname, testCase.Err, hostname, err)
+		}
+	}
+
+	// PTR & forward answers are cached
+	lookups := atomic.LoadInt64(&r.lookups)
+	if _, _, err := c.Hostname(context.Background(), "10.0.0.1"); err != nil {
+		t.Fatal("Hostname err:", err)
+	}
+	if n := atomic.LoadInt64(&r.lookups); n != lookups {
+		t.Fatalf("Must be %v lookups, but %v", lookups, n)
+	}
+}
@@ -0,0 +1,239 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formats of DNS-over-HTTPS answers
+const (
+	FormatWire = "wire" // RFC 8484 DNS message
+	FormatJSON = "json" // JSON API (dns.google/resolve, cloudflare-dns.com/dns-query)
+
+	mimeMessage = "application/dns-message"
+	mimeJSON    = "application/dns-json"
+
+	maxMessageSize = 65535
+)
+
+// DoH - DNS-over-HTTPS server
+type DoH struct {
+	URL     *url.URL
+	Method  string        // GET or POST of wire format, JSON API is always queried by GET
+	Format  string        // wire or json
+	Timeout time.Duration // timeout of exchange, if ctx has no earlier deadline
+
+	client *http.Client
+}
+
+// NewDoH - constructor for DoH struct, method is POST & format is wire if they are empty,
+// connections are reused by transport of client
+func NewDoH(endpoint, method, format string, timeout time.Duration, client *http.Client) (*DoH, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("dns: invalid DoH endpoint `" + endpoint + "`")
+	}
+
+	if method = strings.ToUpper(method); method == "" {
+		method = http.MethodPost
+	}
+	if method != http.MethodGet && method != http.MethodPost {
+		return nil, errors.New("dns: unsupported DoH method `" + method + "`")
+	}
+
+	switch format {
+	case "":
+		format = FormatWire
+	case FormatWire, FormatJSON:
+	default:
+		return nil, errors.New("dns: unsupported DoH format `" + format + "`")
+	}
+
+	return &DoH{URL: u, Method: method, Format: format, Timeout: timeout, client: client}, nil
+}
+
+// Exchange sends query and returns answer of server
+func (d *DoH) Exchange(ctx context.Context, query *Message) (*Message, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	if d.Format == FormatJSON {
+		return d.exchangeJSON(ctx, query)
+	}
+	return d.exchangeWire(ctx, query)
+}
+
+// do sends request & returns body of answer
+func (d *DoH) do(req *http.Request) ([]byte, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("dns: invalid status code: " + resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+}
+
+// exchangeWire exchanges messages of RFC 8484
+func (d *DoH) exchangeWire(ctx context.Context, query *Message) (*Message, error) {
+	// ID is zero for HTTP caches
+	q := *query
+	q.ID = 0
+	msg, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	u := *d.URL
+	var body io.Reader
+	if d.Method == http.MethodGet {
+		values := u.Query()
+		values.Set("dns", base64.RawURLEncoding.EncodeToString(msg))
+		u.RawQuery = values.Encode()
+	} else {
+		body = bytes.NewReader(msg)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, d.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mimeMessage)
+	if body != nil {
+		req.Header.Set("Content-Type", mimeMessage)
+	}
+
+	b, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := Unpack(b)
+	if err != nil {
+		return nil, err
+	}
+	if !answers(resp, &q) {
+		return nil, ErrMessage
+	}
+	resp.ID = query.ID
+	return resp, nil
+}
+
+// jsonRR - resource record of JSON API
+type jsonRR struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// jsonMessage - answer of JSON API
+type jsonMessage struct {
+	Status    int      `json:"Status"`
+	TC        bool     `json:"TC"`
+	RD        bool     `json:"RD"`
+	RA        bool     `json:"RA"`
+	Answer    []jsonRR `json:"Answer"`
+	Authority []jsonRR `json:"Authority"`
+}
+
+// exchangeJSON queries JSON API, its answer is converted to message
+func (d *DoH) exchangeJSON(ctx context.Context, query *Message) (*Message, error) {
+	if len(query.Questions) != 1 {
+		return nil, errors.New("dns: JSON API supports only one question")
+	}
+	question := query.Questions[0]
+
+	u := *d.URL
+	values := u.Query()
+	values.Set("name", question.Name)
+	values.Set("type", strconv.Itoa(int(question.Type)))
+	u.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mimeJSON)
+
+	b, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var answer jsonMessage
+	if err := json.Unmarshal(b, &answer); err != nil {
+		return nil, errors.New("dns: invalid JSON answer err : " + err.Error())
+	}
+
+	resp := &Message{
+		ID:                 query.ID,
+		Response:           true,
+		Truncated:          answer.TC,
+		RecursionDesired:   answer.RD,
+		RecursionAvailable: answer.RA,
+		RCode:              answer.Status,
+		Questions:          query.Questions,
+	}
+	if resp.Answers, err = fromJSON(answer.Answer); err != nil {
+		return nil, err
+	}
+	if resp.Authority, err = fromJSON(answer.Authority); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fromJSON returns resource records by records of JSON API
+func fromJSON(records []jsonRR) ([]RR, error) {
+	rrs := make([]RR, 0, len(records))
+	for _, record := range records {
+		rr := RR{Name: Fqdn(record.Name), Type: record.Type, Class: ClassINET, TTL: record.TTL}
+		switch record.Type {
+		case TypeA, TypeAAAA:
+			if rr.Addr = net.ParseIP(record.Data); rr.Addr == nil {
+				return nil, ErrMessage
+			}
+			if record.Type == TypeA {
+				if rr.Addr = rr.Addr.To4(); rr.Addr == nil {
+					return nil, ErrMessage
+				}
+			}
+		case TypeCNAME, TypeNS, TypePTR:
+			rr.Target = Fqdn(record.Data)
+		case TypeSOA:
+			fields := strings.Fields(record.Data)
+			if len(fields) != 7 {
+				return nil, ErrMessage
+			}
+			rr.NS, rr.MBox = Fqdn(fields[0]), Fqdn(fields[1])
+			for i, field := range []*uint32{&rr.Serial, &rr.Refresh, &rr.Retry, &rr.Expire, &rr.Minimum} {
+				n, err := strconv.ParseUint(fields[i+2], 10, 32)
+				if err != nil {
+					return nil, ErrMessage
+				}
+				*field = uint32(n)
+			}
+		default:
+			rr.Data = []byte(record.Data)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
@@ -0,0 +1,174 @@
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newDoHServer returns in-process DoH server, which answers by handler in wire & JSON formats
+// (path /dns-query & /resolve), conns is number of accepted connections
+func newDoHServer(t *testing.T, handler func(q Question) *Message) (srv *httptest.Server, conns *int64) {
+	t.Helper()
+
+	conns = new(int64)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dns-query", func(w http.ResponseWriter, r *http.Request) {
+		var (
+			b   []byte
+			err error
+		)
+		if r.Method == http.MethodGet {
+			b, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		} else {
+			if r.Header.Get("Content-Type") != mimeMessage {
+				http.Error(w, "invalid content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			b, err = io.ReadAll(r.Body)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query, err := Unpack(b)
+		if err != nil || len(query.Questions) != 1 {
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+
+		resp := handler(query.Questions[0])
+		resp.ID, resp.Response, resp.Questions = query.ID, true, query.Questions
+		b, _ = resp.Pack()
+		w.Header().Set("Content-Type", mimeMessage)
+		w.Write(b)
+	})
+	mux.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		qtype, _ := strconv.Atoi(r.URL.Query().Get("type"))
+		resp := handler(Question{Name: Fqdn(r.URL.Query().Get("name")), Type: uint16(qtype), Class: ClassINET})
+
+		toJSON := func(rrs []RR) (records []jsonRR) {
+			for _, rr := range rrs {
+				record := jsonRR{Name: rr.Name, Type: rr.Type, TTL: rr.TTL}
+				switch rr.Type {
+				case TypeA, TypeAAAA:
+					record.Data = rr.Addr.String()
+				case TypeCNAME, TypeNS, TypePTR:
+					record.Data = rr.Target
+				case TypeSOA:
+					record.Data = rr.NS + " " + rr.MBox + " 1 2 3 4 " + strconv.Itoa(int(rr.Minimum))
+				}
+				records = append(records, record)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", mimeJSON)
+		json.NewEncoder(w).Encode(&jsonMessage{
+			Status:    resp.RCode,
+			RD:        true,
+			RA:        true,
+			Answer:    toJSON(resp.Answers),
+			Authority: toJSON(resp.Authority),
+		})
+	})
+
+	srv = httptest.NewUnstartedServer(mux)
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(conns, 1)
+		}
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, conns
+}
+
+func TestDoHExchange(t *testing.T) {
+	t.Parallel()
+
+	srv, conns := newDoHServer(t, hosts(map[string]string{"example.com.": "1.2.3.4"}))
+	cases := []struct {
+		Path   string
+		Method string
+		Format string
+	}{
+		{Path: "/dns-query", Method: "POST", Format: FormatWire},
+		{Path: "/dns-query", Method: "GET", Format: FormatWire},
+		{Path: "/resolve", Format: FormatJSON},
+	}
+	for _, testCase := range cases {
+		doh, err := NewDoH(srv.URL+testCase.Path, testCase.Method, testCase.Format, time.Second, srv.Client())
+		if err != nil {
+			t.Fatal("NewDoH err:", err)
+		}
+		for i := 0; i < 3; i++ {
+			query := NewQuery(newID(), "example.com", TypeA)
+			resp, err := doh.Exchange(context.Background(), query)
+			if err != nil || resp.ID != query.ID || len(resp.Answers) != 1 || resp.Answers[0].Addr.String() != "1.2.3.4" {
+				t.Fatalf("Case %+v: invalid answer: %+v err: %v", testCase, resp, err)
+			}
+		}
+	}
+
+	// connection is reused by all queries
+	if n := atomic.LoadInt64(conns); n != 1 {
+		t.Fatalf("Must be 1 connection, but %v", n)
+	}
+}
+
+func TestDoHLookupHost(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newDoHServer(t, zone([]RR{
+		{Name: "example.com.", Type: TypeA, Class: ClassINET, TTL: 120, Addr: net.IPv4(1, 2, 3, 4).To4()},
+		{Name: "example.com.", Type: TypeAAAA, Class: ClassINET, TTL: 60, Addr: net.ParseIP("2001:db8::1")},
+	}))
+	for _, path := range []string{"/dns-query", "/resolve"} {
+		format := FormatWire
+		if path == "/resolve" {
+			format = FormatJSON
+		}
+		doh, err := NewDoH(srv.URL+path, "", format, time.Second, srv.Client())
+		if err != nil {
+			t.Fatal("NewDoH err:", err)
+		}
+		client := NewClient([]Exchanger{doh})
+
+		addrs, ttl, err := client.LookupHost(context.Background(), "example.com")
+		sort.Strings(addrs)
+		if err != nil || ttl != time.Minute || !reflect.DeepEqual(addrs, []string{"1.2.3.4", "2001:db8::1"}) {
+			t.Fatalf("Format [%v]: invalid answer: %v %v err: %v", format, addrs, ttl, err)
+		}
+		if _, ttl, err := client.LookupHost(context.Background(), "none.example.com"); err != ErrNotFound || ttl != 30*time.Second {
+			t.Fatalf("Format [%v]: must be err: %v with TTL 30s, but %v %v", format, ErrNotFound, err, ttl)
+		}
+	}
+}
+
+func TestNewDoHNegative(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Endpoint, Method, Format string
+	}{
+		{Endpoint: "http://dns.google/dns-query"},
+		{Endpoint: "https:///dns-query"},
+		{Endpoint: "https://dns.google/dns-query", Method: "PUT"},
+		{Endpoint: "https://dns.google/dns-query", Format: "xml"},
+	}
+	for _, testCase := range cases {
+		if _, err := NewDoH(testCase.Endpoint, testCase.Method, testCase.Format, time.Second, http.DefaultClient); err == nil {
+			t.Fatalf("Case %+v: no error", testCase)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	maxUDPSize  = 4096
+	defaultPort = "53"
+)
+
+// Exchanger - transport of DNS messages to upstream server
+type Exchanger interface {
+	Exchange(ctx context.Context, query *Message) (*Message, error)
+}
+
+// Upstream - DNS server over UDP (TCP is used for truncated answers) or TCP
+type Upstream struct {
+	Net     string // udp or tcp
+	Addr    string
+	Timeout time.Duration // timeout of exchange, if ctx has no earlier deadline
+}
+
+// ParseUpstream returns upstream by URL: udp://host[:port], tcp://host[:port] or host[:port] (UDP)
+func ParseUpstream(raw string, timeout time.Duration) (Exchanger, error) {
+	network, addr := "udp", raw
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		network, addr = u.Scheme, u.Host
+	}
+
+	switch network {
+	case "udp", "tcp":
+	default:
+		return nil, errors.New("dns: unsupported upstream `" + raw + "`")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), defaultPort)
+	}
+	return &Upstream{Net: network, Addr: addr, Timeout: timeout}, nil
+}
+
+// Exchange sends query and returns answer of upstream
+func (u *Upstream) Exchange(ctx context.Context, query *Message) (*Message, error) {
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+
+	resp, err := u.exchange(ctx, u.Net, query)
+	if err == nil && resp.Truncated && u.Net == "udp" {
+		resp, err = u.exchange(ctx, "tcp", query)
+	}
+	return resp, err
+}
+
+func (u *Upstream) exchange(ctx context.Context, network string, query *Message) (*Message, error) {
+	msg, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, u.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// connection is closed, if ctx is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	var resp *Message
+	if network == "tcp" {
+		resp, err = exchangeStream(conn, msg)
+	} else {
+		resp, err = exchangePacket(conn, msg, query)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		// deadline of connection may expire before ctx is done
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return nil, context.DeadlineExceeded
+		}
+		return nil, err
+	}
+	if !answers(resp, query) {
+		return nil, errors.New("dns: answer doesn't match query")
+	}
+	return resp, nil
+}
+
+// exchangePacket exchanges messages over UDP, packets, which don't answer query, are skipped
+func exchangePacket(conn net.Conn, msg []byte, query *Message) (*Message, error) {
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err := Unpack(buf[:n]); err == nil && answers(resp, query) {
+			return resp, nil
+		}
+	}
+}
+
+// exchangeStream exchanges messages with 2-byte length prefix (TCP)
+func exchangeStream(conn net.Conn, msg []byte) (*Message, error) {
+	buf := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	if _, err := conn.Write(append(buf, msg...)); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(buf))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return Unpack(resp)
+}
+
+// answers returns true if resp is answer to query
+func answers(resp, query *Message) bool {
+	if !resp.Response || resp.ID != query.ID || len(resp.Questions) != len(query.Questions) {
+		return false
+	}
+	for i, q := range query.Questions {
+		r := resp.Questions[i]
+		if !strings.EqualFold(r.Name, q.Name) || r.Type != q.Type || r.Class != q.Class {
+			return false
+		}
+	}
+	return true
+}
+
+// newID returns random ID of query (it's unpredictable against spoofed answers)
+func newID() uint16 {
+	var b [2]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
@@ -0,0 +1,201 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server - local stand-in of DNS server over UDP & TCP on the same port
+type server struct {
+	udp net.PacketConn
+	tcp net.Listener
+
+	handler  func(q Question) *Message // returns rcode & records of answer
+	truncate bool                      // UDP answers are truncated
+	queries  int64
+}
+
+func newServer(t *testing.T, handler func(q Question) *Message) *server {
+	t.Helper()
+	return startServer(t, &server{handler: handler})
+}
+
+// startServer starts serving of srv with its settings
+func startServer(t *testing.T, srv *server) *server {
+	t.Helper()
+
+	for i := 0; ; i++ {
+		udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal("Listen err:", err)
+		}
+		tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+		if err == nil {
+			srv.udp, srv.tcp = udp, tcp
+			break
+		}
+		udp.Close()
+		if i == 10 {
+			t.Fatal("Listen err:", err)
+		}
+	}
+	t.Cleanup(func() {
+		srv.udp.Close()
+		srv.tcp.Close()
+	})
+
+	go srv.servePackets()
+	go srv.serveStreams()
+	return srv
+}
+
+func (srv *server) addr() string {
+	return srv.udp.LocalAddr().String()
+}
+
+func (srv *server) answer(b []byte, stream bool) []byte {
+	atomic.AddInt64(&srv.queries, 1)
+	query, err := Unpack(b)
+	if err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+
+	resp := srv.handler(query.Questions[0])
+	resp.ID, resp.Response, resp.Questions = query.ID, true, query.Questions
+	if srv.truncate && !stream {
+		resp.Truncated, resp.Answers = true, nil
+	}
+	b, _ = resp.Pack()
+	return b
+}
+
+func (srv *server) servePackets() {
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, addr, err := srv.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := srv.answer(buf[:n], false); resp != nil {
+			srv.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (srv *server) serveStreams() {
+	for {
+		conn, err := srv.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var length [2]byte
+			for {
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				b := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, b); err != nil {
+					return
+				}
+				resp := srv.answer(b, true)
+				binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+				conn.Write(append(length[:], resp...))
+			}
+		}()
+	}
+}
+
+// hosts returns handler, which answers A records of hosts
+func hosts(records map[string]string) func(q Question) *Message {
+	return func(q Question) *Message {
+		addr, ok := records[q.Name]
+		if !ok {
+			return &Message{RCode: RCodeNameError}
+		}
+		if q.Type != TypeA {
+			return &Message{}
+		}
+		return &Message{Answers: []RR{{Name: q.Name, Type: TypeA, Class: ClassINET, TTL: 60, Addr: net.ParseIP(addr).To4()}}}
+	}
+}
+
+func TestUpstreamExchange(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t, hosts(map[string]string{"example.com.": "1.2.3.4"}))
+	for _, network := range []string{"udp", "tcp"} {
+		upstream := &Upstream{Net: network, Addr: srv.addr(), Timeout: time.Second}
+		resp, err := upstream.Exchange(context.Background(), NewQuery(newID(), "example.com", TypeA))
+		if err != nil || len(resp.Answers) != 1 || resp.Answers[0].Addr.String() != "1.2.3.4" {
+			t.Fatalf("Network [%v]: invalid answer: %+v err: %v", network, resp, err)
+		}
+	}
+}
+
+func TestUpstreamTruncated(t *testing.T) {
+	t.Parallel()
+
+	srv := startServer(t, &server{handler: hosts(map[string]string{"example.com.": "1.2.3.4"}), truncate: true})
+
+	upstream := &Upstream{Net: "udp", Addr: srv.addr(), Timeout: time.Second}
+	resp, err := upstream.Exchange(context.Background(), NewQuery(newID(), "example.com", TypeA))
+	if err != nil || resp.Truncated || len(resp.Answers) != 1 {
+		t.Fatalf("Invalid answer: %+v err: %v", resp, err)
+	}
+	if queries := atomic.LoadInt64(&srv.queries); queries != 2 {
+		t.Fatalf("Must be UDP & TCP queries, but %v queries", queries)
+	}
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	t.Parallel()
+
+	// nobody answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen err:", err)
+	}
+	defer conn.Close()
+
+	upstream := &Upstream{Net: "udp", Addr: conn.LocalAddr().String(), Timeout: time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := upstream.Exchange(ctx, NewQuery(newID(), "example.com", TypeA)); err != context.DeadlineExceeded {
+		t.Fatalf("Must be err: %v, but %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestParseUpstream(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Raw  string
+		Net  string
+		Addr string
+	}{
+		{Raw: "8.8.8.8", Net: "udp", Addr: "8.8.8.8:53"},
+		{Raw: "8.8.8.8:5353", Net: "udp", Addr: "8.8.8.8:5353"},
+		{Raw: "tcp://1.1.1.1", Net: "tcp", Addr: "1.1.1.1:53"},
+		{Raw: "udp://[2001:db8::1]:53", Net: "udp", Addr: "[2001:db8::1]:53"},
+		{Raw: "2001:db8::1", Net: "udp", Addr: "[2001:db8::1]:53"},
+	}
+	for _, testCase := range cases {
+		exchanger, err := ParseUpstream(testCase.Raw, time.Second)
+		if err != nil {
+			t.Fatalf("Upstream [%v]: err: %v", testCase.Raw, err)
+		}
+		if upstream := exchanger.(*Upstream); upstream.Net != testCase.Net || upstream.Addr != testCase.Addr {
+			t.Fatalf("Upstream [%v]: invalid upstream: %+v", testCase.Raw, upstream)
+		}
+	}
+	if _, err := ParseUpstream("quic://8.8.8.8", time.Second); err == nil {
+		t.Fatal("No error of unsupported upstream")
+	}
+}
@@ -0,0 +1,380 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// types of resource records
+const (
+	TypeA     uint16 = 1
+	TypeNS    uint16 = 2
+	TypeCNAME uint16 = 5
+	TypeSOA   uint16 = 6
+	TypePTR   uint16 = 12
+	TypeAAAA  uint16 = 28
+
+	ClassINET uint16 = 1
+)
+
+// response codes
+const (
+	RCodeSuccess    = 0
+	RCodeServerFail = 2
+	RCodeNameError  = 3 // NXDOMAIN
+)
+
+const (
+	headerLen = 12
+	maxPtrs   = 16 // max number of compression pointers in name
+)
+
+var (
+	// ErrMessage - message has invalid format
+	ErrMessage = errors.New("dns: invalid message")
+)
+
+// Question ...
+type Question struct {
+	Name  string // fully qualified (with trailing dot)
+	Type  uint16
+	Class uint16
+}
+
+// RR - resource record, data of known types is decoded to Addr, Target or SOA fields
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+
+	Addr   net.IP // A, AAAA
+	Target string // CNAME, NS, PTR
+	Data   []byte // raw data of other types
+
+	// SOA
+	NS, MBox                                string
+	Serial, Refresh, Retry, Expire, Minimum uint32
+}
+
+// Message - DNS message
+type Message struct {
+	ID                 uint16
+	Response           bool
+	Opcode             int
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	RCode              int
+
+	Questions  []Question
+	Answers    []RR
+	Authority  []RR
+	Additional []RR
+}
+
+// NewQuery returns recursive query about name of qtype
+func NewQuery(id uint16, name string, qtype uint16) *Message {
+	return &Message{
+		ID:               id,
+		RecursionDesired: true,
+		Questions:        []Question{{Name: Fqdn(name), Type: qtype, Class: ClassINET}},
+	}
+}
+
+// Fqdn returns fully qualified name
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// ReverseName returns name of PTR record of addr (in-addr.arpa or ip6.arpa)
+func ReverseName(addr string) (string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", errors.New("dns: invalid addr `" + addr + "`")
+	}
+
+	var b strings.Builder
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(ip4[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String(), nil
+	}
+
+	const hex = "0123456789abcdef"
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0xF])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String(), nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (m *Message) flags() uint16 {
+	flags := uint16(m.Opcode&0xF)<<11 | uint16(m.RCode&0xF)
+	for _, bit := range []struct {
+		Set  bool
+		Mask uint16
+	}{
+		{Set: m.Response, Mask: 1 << 15},
+		{Set: m.Authoritative, Mask: 1 << 10},
+		{Set: m.Truncated, Mask: 1 << 9},
+		{Set: m.RecursionDesired, Mask: 1 << 8},
+		{Set: m.RecursionAvailable, Mask: 1 << 7},
+	} {
+		if bit.Set {
+			flags |= bit.Mask
+		}
+	}
+	return flags
+}
+
+// Pack returns wire format of message (names aren't compressed)
+func (m *Message) Pack() ([]byte, error) {
+	b := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.flags())
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additional)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = packName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, q.Type)
+		b = appendUint16(b, q.Class)
+	}
+	for _, section := range [][]RR{m.Answers, m.Authority, m.Additional} {
+		for i := range section {
+			if b, err = packRR(b, &section[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+func packName(b []byte, name string) ([]byte, error) {
+	name = Fqdn(name)
+	if name == "." {
+		return append(b, 0), nil
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, errors.New("dns: invalid name `" + name + "`")
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+func packRR(b []byte, rr *RR) ([]byte, error) {
+	var err error
+	if b, err = packName(b, rr.Name); err != nil {
+		return nil, err
+	}
+	b = appendUint16(b, rr.Type)
+	b = appendUint16(b, rr.Class)
+	b = appendUint32(b, rr.TTL)
+
+	// length of data is set after data
+	start := len(b)
+	b = append(b, 0, 0)
+	switch rr.Type {
+	case TypeA:
+		ip := rr.Addr.To4()
+		if ip == nil {
+			return nil, errors.New("dns: invalid A record " + rr.Addr.String())
+		}
+		b = append(b, ip...)
+	case TypeAAAA:
+		ip := rr.Addr.To16()
+		if ip == nil {
+			return nil, errors.New("dns: invalid AAAA record " + rr.Addr.String())
+		}
+		b = append(b, ip...)
+	case TypeCNAME, TypeNS, TypePTR:
+		if b, err = packName(b, rr.Target); err != nil {
+			return nil, err
+		}
+	case TypeSOA:
+		if b, err = packName(b, rr.NS); err != nil {
+			return nil, err
+		}
+		if b, err = packName(b, rr.MBox); err != nil {
+			return nil, err
+		}
+		for _, v := range []uint32{rr.Serial, rr.Refresh, rr.Retry, rr.Expire, rr.Minimum} {
+			b = appendUint32(b, v)
+		}
+	default:
+		b = append(b, rr.Data...)
+	}
+	binary.BigEndian.PutUint16(b[start:], uint16(len(b)-start-2))
+	return b, nil
+}
+
+// Unpack decodes message from wire format
+func Unpack(b []byte) (*Message, error) {
+	if len(b) < headerLen {
+		return nil, ErrMessage
+	}
+	flags := binary.BigEndian.Uint16(b[2:])
+	m := &Message{
+		ID:                 binary.BigEndian.Uint16(b[0:]),
+		Response:           flags&(1<<15) != 0,
+		Opcode:             int(flags>>11) & 0xF,
+		Authoritative:      flags&(1<<10) != 0,
+		Truncated:          flags&(1<<9) != 0,
+		RecursionDesired:   flags&(1<<8) != 0,
+		RecursionAvailable: flags&(1<<7) != 0,
+		RCode:              int(flags & 0xF),
+	}
+
+	off := headerLen
+	nquestions := int(binary.BigEndian.Uint16(b[4:]))
+	for i := 0; i < nquestions; i++ {
+		name, next, err := unpackName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(b) {
+			return nil, ErrMessage
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[next:]),
+			Class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+
+	for i, section := range []*[]RR{&m.Answers, &m.Authority, &m.Additional} {
+		n := int(binary.BigEndian.Uint16(b[6+2*i:]))
+		for j := 0; j < n; j++ {
+			rr, next, err := unpackRR(b, off)
+			if err != nil {
+				return nil, err
+			}
+			*section = append(*section, rr)
+			off = next
+		}
+	}
+	return m, nil
+}
+
+// unpackName returns name at off (it may be compressed) and offset after it
+func unpackName(b []byte, off int) (string, int, error) {
+	var (
+		name  strings.Builder
+		next  = -1 // offset after name (it's known after the first pointer)
+		nptrs int
+	)
+	for {
+		if off >= len(b) {
+			return "", 0, ErrMessage
+		}
+		length := int(b[off])
+		switch length & 0xC0 {
+		case 0x00:
+			if length == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				if name.Len() == 0 {
+					return ".", next, nil
+				}
+				return name.String(), next, nil
+			}
+			if off+1+length > len(b) {
+				return "", 0, ErrMessage
+			}
+			name.Write(b[off+1 : off+1+length])
+			name.WriteByte('.')
+			off += 1 + length
+		case 0xC0:
+			if off+2 > len(b) || nptrs >= maxPtrs {
+				return "", 0, ErrMessage
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			nptrs++
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3FFF)
+		default:
+			return "", 0, ErrMessage
+		}
+	}
+}
+
+func unpackRR(b []byte, off int) (rr RR, next int, err error) {
+	if rr.Name, off, err = unpackName(b, off); err != nil {
+		return rr, 0, err
+	}
+	if off+10 > len(b) {
+		return rr, 0, ErrMessage
+	}
+	rr.Type = binary.BigEndian.Uint16(b[off:])
+	rr.Class = binary.BigEndian.Uint16(b[off+2:])
+	rr.TTL = binary.BigEndian.Uint32(b[off+4:])
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	off += 10
+	end := off + length
+	if end > len(b) {
+		return rr, 0, ErrMessage
+	}
+
+	switch rr.Type {
+	case TypeA, TypeAAAA:
+		if (rr.Type == TypeA && length != net.IPv4len) || (rr.Type == TypeAAAA && length != net.IPv6len) {
+			return rr, 0, ErrMessage
+		}
+		rr.Addr = append(net.IP(nil), b[off:end]...)
+	case TypeCNAME, TypeNS, TypePTR:
+		if rr.Target, _, err = unpackName(b, off); err != nil {
+			return rr, 0, err
+		}
+	case TypeSOA:
+		if rr.NS, off, err = unpackName(b, off); err != nil {
+			return rr, 0, err
+		}
+		if rr.MBox, off, err = unpackName(b, off); err != nil {
+			return rr, 0, err
+		}
+		if off+20 > end {
+			return rr, 0, ErrMessage
+		}
+		rr.Serial = binary.BigEndian.Uint32(b[off:])
+		rr.Refresh = binary.BigEndian.Uint32(b[off+4:])
+		rr.Retry = binary.BigEndian.Uint32(b[off+8:])
+		rr.Expire = binary.BigEndian.Uint32(b[off+12:])
+		rr.Minimum = binary.BigEndian.Uint32(b[off+16:])
+	default:
+		rr.Data = append([]byte(nil), b[off:end]...)
+	}
+	return rr, end, nil
+}
@@ -0,0 +1,116 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestMessagePackUnpack(t *testing.T) {
+	t.Parallel()
+
+	msg := &Message{
+		ID:                 0xBEEF,
+		Response:           true,
+		RecursionDesired:   true,
+		RecursionAvailable: true,
+		RCode:              RCodeNameError,
+		Questions:          []Question{{Name: "example.com.", Type: TypeA, Class: ClassINET}},
+		Answers: []RR{
+			{Name: "example.com.", Type: TypeCNAME, Class: ClassINET, TTL: 30, Target: "www.example.com."},
+			{Name: "www.example.com.", Type: TypeA, Class: ClassINET, TTL: 60, Addr: net.IPv4(1, 2, 3, 4).To4()},
+			{Name: "www.example.com.", Type: TypeAAAA, Class: ClassINET, TTL: 60, Addr: net.ParseIP("2001:db8::1")},
+			{Name: "4.3.2.1.in-addr.arpa.", Type: TypePTR, Class: ClassINET, TTL: 60, Target: "host.example.com."},
+			{Name: "example.com.", Type: 16, Class: ClassINET, TTL: 60, Data: []byte("\x04text")},
+		},
+		Authority: []RR{
+			{Name: "example.com.", Type: TypeSOA, Class: ClassINET, TTL: 300, NS: "ns.example.com.", MBox: "root.example.com.",
+				Serial: 1, Refresh: 2, Retry: 3, Expire: 4, Minimum: 5},
+		},
+	}
+
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal("Pack err:", err)
+	}
+	unpacked, err := Unpack(b)
+	if err != nil {
+		t.Fatal("Unpack err:", err)
+	}
+	if !reflect.DeepEqual(msg, unpacked) {
+		t.Fatalf("Invalid message:\nexpected: %+v\nactual:   %+v", msg, unpacked)
+	}
+}
+
+func TestUnpackCompressed(t *testing.T) {
+	t.Parallel()
+
+	b := []byte{
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0,
+		// question: example.com. A IN
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1,
+		// answer: pointer to question name, A IN, TTL 60, 1.2.3.4
+		0xC0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 1, 2, 3, 4,
+	}
+	msg, err := Unpack(b)
+	if err != nil {
+		t.Fatal("Unpack err:", err)
+	}
+	if len(msg.Answers) != 1 || msg.Answers[0].Name != "example.com." || msg.Answers[0].Addr.String() != "1.2.3.4" ||
+		msg.Answers[0].TTL != 60 || !msg.Response || msg.ID != 0x1234 {
+		t.Fatalf("Invalid message: %+v", msg)
+	}
+}
+
+func TestUnpackNegative(t *testing.T) {
+	t.Parallel()
+
+	cases := [][]byte{
+		{0x12, 0x34},
+		// question without end of name
+		{0x12, 0x34, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 7, 'e', 'x'},
+		// pointer loop
+		{0x12, 0x34, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 0xC0, 12, 0, 1, 0, 1},
+		// A record with invalid length
+		{0x12, 0x34, 0x81, 0x80, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 3, 1, 2, 3},
+		// data is out of message
+		{0x12, 0x34, 0x81, 0x80, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 1, 2},
+	}
+	for i, b := range cases {
+		if msg, err := Unpack(b); err == nil {
+			t.Fatalf("Case [%v]: no error, message: %+v", i, msg)
+		}
+	}
+}
+
+func TestPackNegative(t *testing.T) {
+	t.Parallel()
+
+	cases := []*Message{
+		{Questions: []Question{{Name: "a..b."}}},
+		{Answers: []RR{{Name: "a.", Type: TypeA, Addr: net.ParseIP("2001:db8::1")}}},
+	}
+	for i, msg := range cases {
+		if _, err := msg.Pack(); err == nil {
+			t.Fatalf("Case [%v]: no error", i)
+		}
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"1.2.3.4":     "4.3.2.1.in-addr.arpa.",
+		"192.168.0.1": "1.0.168.192.in-addr.arpa.",
+		"2001:db8::1": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+	}
+	for addr, expected := range cases {
+		if name, err := ReverseName(addr); err != nil || name != expected {
+			t.Fatalf("Addr [%v]: must be %v, but %v err: %v", addr, expected, name, err)
+		}
+	}
+	if _, err := ReverseName("example.com"); err == nil {
+		t.Fatal("No error of invalid addr")
+	}
+}
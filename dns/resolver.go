@@ -0,0 +1,197 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotFound - host has no addresses (NXDOMAIN or empty answer)
+	ErrNotFound = errors.New("dns: no such host")
+
+	// ErrNotConfirmed - no name of addr resolves back to addr
+	ErrNotConfirmed = errors.New("dns: name of addr isn't confirmed by forward lookup")
+)
+
+// UnknownTTL - TTL of answer, which has no TTL (e.g. answer of net package), zero TTL is real one
+const UnknownTTL time.Duration = -1
+
+// Resolver - lookups of hosts
+type Resolver interface {
+	// LookupHost returns addrs of host and TTL of answer (UnknownTTL if it's unknown),
+	// TTL of ErrNotFound is TTL of negative answer
+	LookupHost(ctx context.Context, host string) (addrs []string, ttl time.Duration, err error)
+
+	// LookupAddr returns names of addr (fully qualified) by PTR records and TTL of answer like LookupHost
+	LookupAddr(ctx context.Context, addr string) (names []string, ttl time.Duration, err error)
+}
+
+// NetResolver - Go or system resolver of net package (TTLs of answers are unknown)
+type NetResolver struct {
+	resolver *net.Resolver
+}
+
+// NewNetResolver - constructor for NetResolver struct, system resolver is used
+// if preferGo is false (it's libc one if binary is built with cgo)
+func NewNetResolver(preferGo bool) *NetResolver {
+	if !preferGo {
+		return &NetResolver{resolver: net.DefaultResolver}
+	}
+	return &NetResolver{resolver: &net.Resolver{PreferGo: true}}
+}
+
+// LookupHost returns addrs of host
+func (r *NetResolver) LookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	return addrs, UnknownTTL, notFound(err)
+}
+
+// LookupAddr returns names of addr
+func (r *NetResolver) LookupAddr(ctx context.Context, addr string) ([]string, time.Duration, error) {
+	names, err := r.resolver.LookupAddr(ctx, addr)
+	return names, UnknownTTL, notFound(err)
+}
+
+// notFound replaces not found error of net package by ErrNotFound
+func notFound(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Client - stub resolver, which queries upstream servers in order until one of them answers
+type Client struct {
+	upstreams []Exchanger
+}
+
+// NewClient - constructor for Client struct
+func NewClient(upstreams []Exchanger) *Client {
+	return &Client{upstreams: upstreams}
+}
+
+// exchange returns answer of the first upstream, which has answered query
+func (c *Client) exchange(ctx context.Context, name string, qtype uint16) (*Message, error) {
+	err := errors.New("dns: no upstreams")
+	for _, upstream := range c.upstreams {
+		var resp *Message
+		resp, err = upstream.Exchange(ctx, NewQuery(newID(), name, qtype))
+		if err == nil && resp.RCode != RCodeSuccess && resp.RCode != RCodeNameError {
+			err = errors.New("dns: upstream error, rcode " + strconv.Itoa(resp.RCode))
+		}
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// ttl returns min TTL of records
+func ttl(records []RR) time.Duration {
+	var min uint32
+	for i, rr := range records {
+		if i == 0 || rr.TTL < min {
+			min = rr.TTL
+		}
+	}
+	return time.Duration(min) * time.Second
+}
+
+// negativeTTL returns TTL of negative answer by SOA record of authority section (UnknownTTL without SOA)
+func negativeTTL(resp *Message) time.Duration {
+	for _, rr := range resp.Authority {
+		if rr.Type == TypeSOA {
+			if rr.Minimum < rr.TTL {
+				return time.Duration(rr.Minimum) * time.Second
+			}
+			return time.Duration(rr.TTL) * time.Second
+		}
+	}
+	return UnknownTTL
+}
+
+// LookupHost returns IPv4 & IPv6 addrs of host
+func (c *Client) LookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, UnknownTTL, nil
+	}
+
+	type result struct {
+		resp *Message
+		err  error
+	}
+	qtypes := []uint16{TypeA, TypeAAAA}
+	results := make([]chan result, len(qtypes))
+	for i, qtype := range qtypes {
+		results[i] = make(chan result, 1)
+		go func(ch chan result, qtype uint16) {
+			resp, err := c.exchange(ctx, host, qtype)
+			ch <- result{resp: resp, err: err}
+		}(results[i], qtype)
+	}
+
+	var (
+		addrs    []string
+		records  []RR
+		negative = UnknownTTL
+		nxdomain bool
+		err      error
+	)
+	for i, ch := range results {
+		res := <-ch
+		switch {
+		case res.err != nil:
+			err = res.err
+		case res.resp.RCode == RCodeNameError:
+			nxdomain, negative = true, negativeTTL(res.resp)
+		default:
+			records = append(records, res.resp.Answers...)
+			for _, rr := range res.resp.Answers {
+				if rr.Type == qtypes[i] {
+					addrs = append(addrs, rr.Addr.String())
+				}
+			}
+			if len(addrs) == 0 {
+				negative = negativeTTL(res.resp)
+			}
+		}
+	}
+
+	switch {
+	case len(addrs) > 0:
+		return addrs, ttl(records), nil
+	case err != nil && !nxdomain:
+		return nil, 0, err
+	}
+	return nil, negative, ErrNotFound
+}
+
+// LookupAddr returns names of addr by PTR records
+func (c *Client) LookupAddr(ctx context.Context, addr string) ([]string, time.Duration, error) {
+	name, err := ReverseName(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.exchange(ctx, name, TypePTR)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var names []string
+	for _, rr := range resp.Answers {
+		if rr.Type == TypePTR {
+			names = append(names, rr.Target)
+		}
+	}
+	if len(names) == 0 {
+		return nil, negativeTTL(resp), ErrNotFound
+	}
+	return names, ttl(resp.Answers), nil
+}
@@ -0,0 +1,123 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// zone returns handler, which answers by records of zone (SOA in authority section of negative answers)
+func zone(records []RR) func(q Question) *Message {
+	soa := RR{Name: "example.com.", Type: TypeSOA, Class: ClassINET, TTL: 300, NS: "ns.example.com.",
+		MBox: "root.example.com.", Minimum: 30}
+	return func(q Question) *Message {
+		var (
+			resp  = &Message{}
+			name  = q.Name
+			found bool
+		)
+		for _, rr := range records {
+			if rr.Name != name {
+				continue
+			}
+			found = true
+			if rr.Type == TypeCNAME {
+				resp.Answers = append(resp.Answers, rr)
+				name = rr.Target
+			}
+		}
+		nodata := true
+		for _, rr := range records {
+			if rr.Name == name && rr.Type == q.Type {
+				resp.Answers, nodata = append(resp.Answers, rr), false
+			}
+		}
+		if !found {
+			resp.RCode = RCodeNameError
+		}
+		if nodata {
+			resp.Authority = []RR{soa}
+		}
+		return resp
+	}
+}
+
+func TestClientLookupHost(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t, zone([]RR{
+		{Name: "example.com.", Type: TypeA, Class: ClassINET, TTL: 120, Addr: net.IPv4(1, 2, 3, 4).To4()},
+		{Name: "example.com.", Type: TypeAAAA, Class: ClassINET, TTL: 60, Addr: net.ParseIP("2001:db8::1")},
+		{Name: "www.example.com.", Type: TypeCNAME, Class: ClassINET, TTL: 40, Target: "web.example.com."},
+		{Name: "web.example.com.", Type: TypeA, Class: ClassINET, TTL: 90, Addr: net.IPv4(5, 6, 7, 8).To4()},
+		{Name: "empty.example.com.", Type: TypeCNAME, Class: ClassINET, TTL: 90, Target: "example.net."},
+	}))
+	client := NewClient([]Exchanger{&Upstream{Net: "udp", Addr: srv.addr(), Timeout: time.Second}})
+
+	cases := []struct {
+		Host  string
+		Addrs []string
+		TTL   time.Duration
+		Err   error
+	}{
+		{Host: "example.com", Addrs: []string{"1.2.3.4", "2001:db8::1"}, TTL: 60 * time.Second},
+		{Host: "www.example.com.", Addrs: []string{"5.6.7.8"}, TTL: 40 * time.Second},
+		{Host: "10.0.0.1", Addrs: []string{"10.0.0.1"}, TTL: UnknownTTL},
+		{Host: "none.example.com", TTL: 30 * time.Second, Err: ErrNotFound},
+		{Host: "empty.example.com", TTL: 30 * time.Second, Err: ErrNotFound},
+	}
+	for _, testCase := range cases {
+		addrs, ttl, err := client.LookupHost(context.Background(), testCase.Host)
+		sort.Strings(addrs)
+		if err != testCase.Err || ttl != testCase.TTL || !reflect.DeepEqual(addrs, testCase.Addrs) {
+			t.Fatalf("Host [%v]: expected: %v %v %v, actual: %v %v %v", testCase.Host,
+				testCase.Addrs, testCase.TTL, testCase.Err, addrs, ttl, err)
+		}
+	}
+}
+
+func TestClientFallback(t *testing.T) {
+	t.Parallel()
+
+	failed := newServer(t, func(q Question) *Message {
+		return &Message{RCode: RCodeServerFail}
+	})
+	srv := newServer(t, hosts(map[string]string{"example.com.": "1.2.3.4"}))
+	client := NewClient([]Exchanger{
+		&Upstream{Net: "udp", Addr: failed.addr(), Timeout: time.Second},
+		&Upstream{Net: "udp", Addr: srv.addr(), Timeout: time.Second},
+	})
+
+	addrs, _, err := client.LookupHost(context.Background(), "example.com")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"1.2.3.4"}) {
+		t.Fatalf("Invalid answer: %v err: %v", addrs, err)
+	}
+
+	client = NewClient([]Exchanger{&Upstream{Net: "udp", Addr: failed.addr(), Timeout: time.Second}})
+	if _, _, err := client.LookupHost(context.Background(), "example.com"); err == nil || err == ErrNotFound {
+		t.Fatalf("Must be upstream error, but %v", err)
+	}
+}
+
+func TestClientLookupAddr(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t, zone([]RR{
+		{Name: "4.3.2.1.in-addr.arpa.", Type: TypePTR, Class: ClassINET, TTL: 90, Target: "host.example.com."},
+	}))
+	client := NewClient([]Exchanger{&Upstream{Net: "udp", Addr: srv.addr(), Timeout: time.Second}})
+
+	names, ttl, err := client.LookupAddr(context.Background(), "1.2.3.4")
+	if err != nil || ttl != 90*time.Second || !reflect.DeepEqual(names, []string{"host.example.com."}) {
+		t.Fatalf("Invalid answer: %v %v err: %v", names, ttl, err)
+	}
+	if _, ttl, err := client.LookupAddr(context.Background(), "5.6.7.8"); err != ErrNotFound || ttl != 30*time.Second {
+		t.Fatalf("Must be err: %v with TTL 30s, but %v %v", ErrNotFound, err, ttl)
+	}
+	if _, _, err := client.LookupAddr(context.Background(), "example.com"); err == nil {
+		t.Fatal("No error of invalid addr")
+	}
+}
@@ -2,15 +2,23 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/searchinform/cache"
+	"github.com/searchinform/cluster"
+	"github.com/searchinform/dns"
 	"github.com/searchinform/provider"
+	"github.com/searchinform/resp"
 )
 
 // Duration - custom duration
@@ -34,14 +42,97 @@ func (d *Duration) UnmarshalJSON(data []byte) (err error) {
 	return
 }
 
+// RefreshConfig - settings of proactive refresh of hot cache entries
+type RefreshConfig struct {
+	Period   Duration `json:"period"`   // disabled if zero
+	Ahead    Duration `json:"ahead"`    // refresh entries, which expire in less than ahead
+	Fraction float64  `json:"fraction"` // use only providers with rate below this fraction of max_rate
+}
+
+// StateConfig - settings of persistent provider rates
+type StateConfig struct {
+	Path   string   `json:"path"`   // rates aren't persisted if empty
+	Period Duration `json:"period"` // period of checkpoints (only on shutdown if zero)
+}
+
+// HedgeConfig - settings of hedged requests
+type HedgeConfig struct {
+	Quantile float64  `json:"quantile"`  // quantile of provider latency to wait before hedge, disabled if zero
+	MinDelay Duration `json:"min_delay"` // lower bound of wait (used while latency of provider is unknown)
+	Budget   float64  `json:"budget"`    // max number of hedges as fraction of requests to providers
+}
+
+// ProviderHTTPConfig - overrides of HTTP client settings for provider
+type ProviderHTTPConfig struct {
+	Timeout      Duration `json:"timeout"`
+	DialTimeout  Duration `json:"dial_timeout"`
+	Proxy        string   `json:"proxy"`          // http://, https:// or socks5:// URL
+	CAFile       string   `json:"ca_file"`        // PEM bundle of CAs in addition to system ones
+	CertFile     string   `json:"cert_file"`      // client certificate (mTLS)
+	KeyFile      string   `json:"key_file"`       // key of client certificate
+	MaxIdleConns int      `json:"max_idle_conns"` // connection pool size (max_rate of provider if zero)
+}
+
+// DNSConfig - settings of host lookups
+type DNSConfig struct {
+	Resolver string   `json:"resolver"` // system (default), go or upstream
+	Servers  []string `json:"servers"`  // servers of upstream resolver: host[:port], udp://, tcp:// or https:// (DoH) URL
+	Timeout  Duration `json:"timeout"`  // timeout of query to upstream server
+
+	DoH struct {
+		Method string `json:"method"` // POST (default) or GET
+		Format string `json:"format"` // wire (default, RFC 8484) or json (JSON API)
+	} `json:"doh"`
+
+	NPartitions int      `json:"npartitions"`  // npartitions of cache is used if zero
+	TTL         Duration `json:"ttl"`          // TTL of answers of system & go resolvers, answers aren't cached if zero
+	NegativeTTL Duration `json:"negative_ttl"` // TTL of NXDOMAIN without SOA, it isn't cached if zero
+	MinTTL      Duration `json:"min_ttl"`
+	MaxTTL      Duration `json:"max_ttl"` // disabled if zero
+}
+
 // Config - configuration format
 type Config struct {
 	Cache struct {
-		TTL         Duration `json:"ttl"`
-		NPartitions int      `json:"npartitions"`
+		TTL         Duration      `json:"ttl"`
+		NPartitions int           `json:"npartitions"`
+		Refresh     RefreshConfig `json:"refresh"`
+
+		MinTTL      Duration            `json:"min_ttl"`
+		MaxTTL      Duration            `json:"max_ttl"`
+		Jitter      float64             `json:"jitter"`       // fraction of TTL
+		ProviderTTL map[string]Duration `json:"provider_ttl"` // TTL overrides per provider
 	} `json:"cache"`
 
+	L2 struct {
+		Addr     string   `json:"addr"` // L2 is disabled if empty
+		Password string   `json:"password"`
+		DB       int      `json:"db"`
+		Prefix   string   `json:"prefix"`
+		TTL      Duration `json:"ttl"`
+		Timeout  Duration `json:"timeout"`
+		Retry    Duration `json:"retry"` // pause after failure
+		MaxIdle  int      `json:"max_idle"`
+		Queue    int      `json:"queue"`   // size of queue of writes (1024 if zero), writes are dropped if it's full
+		Workers  int      `json:"workers"` // number of writers of queue (4 if zero)
+	} `json:"l2"`
+
+	Cluster struct {
+		Self     string   `json:"self"`  // URL of this replica in peers list
+		Peers    []string `json:"peers"` // URLs of all replicas, cluster is disabled if empty
+		Replicas int      `json:"replicas"`
+		Secret   string   `json:"secret"`
+		Timeout  Duration `json:"timeout"`
+
+		// period of exchange of provider request counts, cluster-wide rate accounting is disabled if zero
+		GossipPeriod Duration `json:"gossip_period"`
+	} `json:"cluster"`
+
 	Providers []provider.Provider `json:"providers"`
+	Strategy  string              `json:"strategy"` // provider selection strategy (sticky by default)
+	Hedge     HedgeConfig         `json:"hedge"`
+	State     StateConfig         `json:"state"`
+	DNS       DNSConfig           `json:"dns"`
 
 	HTTP struct {
 		Port int `json:"port"`
@@ -50,8 +141,14 @@ type Config struct {
 		DialTimeout         Duration `json:"dial_timeout"`
 		KeepAliveTimeout    Duration `json:"keepalive_timeout"`
 		TLSHandshakeTimeout Duration `json:"tls_handshake_timeout"`
+
+		Providers map[string]ProviderHTTPConfig `json:"providers"` // overrides by provider name
 	} `json:"http"`
 
+	Admin struct {
+		Token string `json:"token"` // admin API is disabled if empty
+	} `json:"admin"`
+
 	Log struct {
 		IsDate         bool   `json:"is_date"`
 		IsTime         bool   `json:"is_time"`
@@ -61,6 +158,21 @@ type Config struct {
 	} `json:"log"`
 }
 
+// placeholders - secrets of sample config, they are publicly known
+var placeholders = map[string]bool{
+	"SomeAdminToken": true,
+	"SomePeerSecret": true,
+}
+
+func isPeer(peers []string, self string) bool {
+	for _, peer := range peers {
+		if peer == self {
+			return true
+		}
+	}
+	return false
+}
+
 // ParseConfig - parse config by file path
 func ParseConfig(path string) (*Config, error) {
 	file, err := os.Open(path)
@@ -73,6 +185,36 @@ func ParseConfig(path string) (*Config, error) {
 	if e := json.NewDecoder(file).Decode(conf); e != nil {
 		return nil, e
 	}
+	if placeholders[conf.Admin.Token] {
+		return nil, errors.New("admin token is placeholder of sample config, set own one")
+	}
+	if cluster := &conf.Cluster; len(cluster.Peers) > 0 && (cluster.Secret == "" || placeholders[cluster.Secret]) {
+		return nil, errors.New("cluster secret must be set if peers are configured (placeholder of sample config isn't allowed)")
+	}
+	if cluster := &conf.Cluster; len(cluster.Peers) > 0 && !isPeer(cluster.Peers, cluster.Self) {
+		// otherwise replica forwards even own addrs to peers
+		return nil, errors.New("cluster self `" + cluster.Self + "` must be one of cluster peers")
+	}
+	if jitter := conf.Cache.Jitter; jitter < 0 || jitter >= 1 {
+		return nil, errors.New("cache jitter must be in [0, 1)")
+	}
+	if refresh := &conf.Cache.Refresh; refresh.Period.Duration > 0 && (refresh.Fraction <= 0 || refresh.Fraction > 1) {
+		return nil, errors.New("refresh fraction must be in (0, 1] if refresh is enabled")
+	}
+	for i := range conf.Providers {
+		if e := conf.Providers[i].Compile(); e != nil {
+			return nil, errors.New("provider " + conf.Providers[i].Name + " err : " + e.Error())
+		}
+	}
+	if _, e := provider.NewStrategy(conf.Strategy, conf.Providers); e != nil {
+		return nil, e
+	}
+	if _, e := NewFactory(conf).NewProviderHTTPClients(); e != nil {
+		return nil, e
+	}
+	if _, e := NewFactory(conf).NewDNSResolver(http.DefaultTransport); e != nil {
+		return nil, errors.New("dns err : " + e.Error())
+	}
 	return conf, nil
 }
 
@@ -108,15 +250,158 @@ func (f *Factory) NewLogger() *log.Logger {
 	return log.New(os.Stdout, conf.Prefix, flags)
 }
 
+// NewCachePolicy returns TTL policy with correct settings
+func (f *Factory) NewCachePolicy() cache.Policy {
+	conf := &f.Config.Cache
+	providers := make(map[string]time.Duration, len(conf.ProviderTTL))
+	for name, ttl := range conf.ProviderTTL {
+		providers[name] = ttl.Duration
+	}
+	return cache.Policy{
+		Min:       conf.MinTTL.Duration,
+		Max:       conf.MaxTTL.Duration,
+		Jitter:    conf.Jitter,
+		Providers: providers,
+	}
+}
+
 // NewCache returns cache with correct settings
-func (f *Factory) NewCache() *cache.Cache {
+func (f *Factory) NewCache() *cache.Cache[string, string] {
 	conf := &f.Config.Cache
-	return cache.NewCache(conf.NPartitions, conf.TTL.Duration)
+	return cache.NewCacheWithPolicy(conf.NPartitions, conf.TTL.Duration, f.NewCachePolicy())
+}
+
+// NewConsensusCache returns cache of consensus answers with correct settings
+func (f *Factory) NewConsensusCache() *cache.Cache[string, Consensus] {
+	conf := &f.Config.Cache
+	return cache.New[string, Consensus](conf.NPartitions, conf.TTL.Duration, cache.StringHasher, f.NewCachePolicy())
+}
+
+// NewHostnameCache returns cache of names of addrs with the same TTL policy as countries
+func (f *Factory) NewHostnameCache() *cache.Cache[string, string] {
+	return f.NewCache()
+}
+
+// NewL2 returns second tier of cache with correct settings (nil if it's disabled)
+func (f *Factory) NewL2() *L2 {
+	conf := &f.Config.L2
+	if conf.Addr == "" {
+		return nil
+	}
+	queue, workers := conf.Queue, conf.Workers
+	if queue == 0 {
+		queue = 1024
+	}
+	if workers == 0 {
+		workers = 4
+	}
+	client := resp.NewClient(conf.Addr, conf.Password, conf.DB, conf.Timeout.Duration, conf.MaxIdle)
+	return NewL2(client, conf.Prefix, conf.TTL.Duration, conf.Retry.Duration, queue, workers, f.NewLogger())
+}
+
+// NewPeers returns replicas of cluster with correct settings (nil if it's disabled)
+func (f *Factory) NewPeers() *Peers {
+	conf := &f.Config.Cluster
+	if len(conf.Peers) == 0 {
+		return nil
+	}
+
+	client := f.NewDefaultHTTPClient()
+	client.Timeout = conf.Timeout.Duration
+	return NewPeers(cluster.NewRing(conf.Peers, conf.Replicas), conf.Self, conf.Secret, client)
+}
+
+// NewGossip returns exchange of provider request counts with correct settings (nil if it's disabled)
+func (f *Factory) NewGossip() *cluster.Gossip {
+	conf := &f.Config.Cluster
+	if len(conf.Peers) == 0 || conf.GossipPeriod.Duration <= 0 {
+		return nil
+	}
+
+	client := f.NewDefaultHTTPClient()
+	client.Timeout = conf.Timeout.Duration
+	return cluster.NewGossip(conf.Self, conf.Peers, conf.Secret, client, f.NewLogger())
 }
 
 // NewProviders returns provider list with correct settings
 func (f *Factory) NewProviders() *provider.Iterator {
-	return provider.NewIterator(f.Config.Providers)
+	iter := provider.NewIterator(f.Config.Providers)
+	iter.SetStrategy(f.Config.Strategy) // strategy is checked by ParseConfig
+	return iter
+}
+
+// NewHedger returns hedged requests with correct settings (nil if they are disabled)
+func (f *Factory) NewHedger() *Hedger {
+	conf := &f.Config.Hedge
+	if conf.Quantile <= 0 || conf.Budget <= 0 {
+		return nil
+	}
+	return NewHedger(conf.Quantile, conf.MinDelay.Duration, conf.Budget)
+}
+
+// NewDNSResolver returns resolver of hosts by DNS settings, DoH servers are queried through transport
+func (f *Factory) NewDNSResolver(transport http.RoundTripper) (dns.Resolver, error) {
+	conf := &f.Config.DNS
+	switch conf.Resolver {
+	case "", "system":
+		return dns.NewNetResolver(false), nil
+	case "go":
+		return dns.NewNetResolver(true), nil
+	case "upstream":
+	default:
+		return nil, errors.New("unknown resolver `" + conf.Resolver + "`")
+	}
+
+	if len(conf.Servers) == 0 {
+		return nil, errors.New("no servers of upstream resolver")
+	}
+	client := &http.Client{Transport: transport}
+	upstreams := make([]dns.Exchanger, 0, len(conf.Servers))
+	for _, server := range conf.Servers {
+		var (
+			upstream dns.Exchanger
+			err      error
+		)
+		if strings.HasPrefix(server, "https://") {
+			upstream, err = dns.NewDoH(server, conf.DoH.Method, conf.DoH.Format, conf.Timeout.Duration, client)
+		} else {
+			upstream, err = dns.ParseUpstream(server, conf.Timeout.Duration)
+		}
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	return dns.NewClient(upstreams), nil
+}
+
+// NewResolver returns resolver of hosts with cache of answers, connections to DoH servers are reused by transport
+func (f *Factory) NewResolver(transport http.RoundTripper) *dns.Cache {
+	conf := &f.Config.DNS
+	resolver, _ := f.NewDNSResolver(transport) // settings are checked by ParseConfig
+
+	npartitions := conf.NPartitions
+	if npartitions == 0 {
+		npartitions = f.Config.Cache.NPartitions
+	}
+	return dns.NewCache(resolver, npartitions, conf.TTL.Duration, conf.NegativeTTL.Duration,
+		conf.MinTTL.Duration, conf.MaxTTL.Duration)
+}
+
+// newTransport returns http.Transport with correct settings
+func (f *Factory) newTransport(dialTimeout time.Duration, maxIdle int) *http.Transport {
+	conf := &f.Config.HTTP
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: conf.KeepAliveTimeout.Duration,
+	}
+	return &http.Transport{
+		Dial:                dialer.Dial,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: conf.TLSHandshakeTimeout.Duration,
+		MaxIdleConnsPerHost: maxIdle,
+		IdleConnTimeout:     conf.KeepAliveTimeout.Duration,
+	}
 }
 
 // NewDefaultHTTPClient returns http.Client with correct settings
@@ -129,33 +414,140 @@ func (f *Factory) NewDefaultHTTPClient() *http.Client {
 	}
 
 	conf := &f.Config.HTTP
-	dialer := &net.Dialer{
-		Timeout:   conf.DialTimeout.Duration,
-		KeepAlive: conf.KeepAliveTimeout.Duration,
-	}
 	return &http.Client{
-		Transport: &http.Transport{
-			Dial:                dialer.Dial,
-			DialContext:         dialer.DialContext,
-			TLSHandshakeTimeout: conf.TLSHandshakeTimeout.Duration,
-			MaxIdleConnsPerHost: int(maxrate),
-			IdleConnTimeout:     conf.KeepAliveTimeout.Duration,
-		},
-		Timeout: conf.Timeout.Duration,
+		Transport: f.newTransport(conf.DialTimeout.Duration, int(maxrate)),
+		Timeout:   conf.Timeout.Duration,
+	}
+}
+
+// newTLSConfig returns TLS settings with CA bundle & client certificate (nil if they aren't set)
+func newTLSConfig(conf *ProviderHTTPConfig) (*tls.Config, error) {
+	if conf.KeyFile != "" && conf.CertFile == "" {
+		return nil, errors.New("key_file is set without cert_file")
+	}
+	if conf.CAFile == "" && conf.CertFile == "" {
+		return nil, nil
+	}
+
+	tlsConf := &tls.Config{}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConf.RootCAs, err = x509.SystemCertPool(); err != nil {
+			tlsConf.RootCAs = x509.NewCertPool()
+		}
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in " + conf.CAFile)
+		}
+	}
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConf, nil
+}
+
+// NewProviderHTTPClient returns http.Client with settings of provider p
+func (f *Factory) NewProviderHTTPClient(p *provider.Provider, conf *ProviderHTTPConfig) (*http.Client, error) {
+	global := &f.Config.HTTP
+	timeout, dialTimeout, maxIdle := conf.Timeout.Duration, conf.DialTimeout.Duration, conf.MaxIdleConns
+	if timeout == 0 {
+		timeout = global.Timeout.Duration
+	}
+	if dialTimeout == 0 {
+		dialTimeout = global.DialTimeout.Duration
+	}
+	if maxIdle == 0 {
+		maxIdle = int(p.MaxRate)
+		for _, key := range p.Keys {
+			maxIdle += int(key.MaxRate)
+		}
+	}
+
+	transport := f.newTransport(dialTimeout, maxIdle)
+	if conf.Proxy != "" {
+		proxy, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, errors.New("unsupported proxy scheme `" + proxy.Scheme + "`")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
 	}
+
+	var err error
+	if transport.TLSClientConfig, err = newTLSConfig(conf); err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// NewProviderHTTPClients returns http.Client of every provider with overrides of HTTP settings
+func (f *Factory) NewProviderHTTPClients() (map[string]*http.Client, error) {
+	overrides := f.Config.HTTP.Providers
+	clients := make(map[string]*http.Client, len(overrides))
+	for i := range f.Config.Providers {
+		p := &f.Config.Providers[i]
+		conf, ok := overrides[p.Name]
+		if !ok {
+			continue
+		}
+		client, err := f.NewProviderHTTPClient(p, &conf)
+		if err != nil {
+			return nil, errors.New("http settings of provider " + p.Name + " err : " + err.Error())
+		}
+		clients[p.Name] = client
+	}
+
+	for name := range overrides {
+		if _, ok := clients[name]; !ok {
+			return nil, errors.New("http settings of unknown provider " + name)
+		}
+	}
+	return clients, nil
 }
 
 // NewHTTPClient returns custom HTTP Client with correct settings
 func (f *Factory) NewHTTPClient() *HTTPClient {
-	return NewHTTPClient(f.NewDefaultHTTPClient(), f.NewProviders())
+	clients, _ := f.NewProviderHTTPClients() // settings are checked by ParseConfig
+	return NewHTTPClient(f.NewDefaultHTTPClient(), clients)
 }
 
 // NewController returns Controller with correct settings
 func (f *Factory) NewController() *Controller {
-	return &Controller{
-		cache:     *f.NewCache(),
-		providers: *f.NewProviders(),
-		client:    *f.NewHTTPClient(),
-		logger:    *f.NewLogger(),
+	providers, gossip := f.NewProviders(), f.NewGossip()
+	if gossip != nil {
+		providers.Share(gossip)
+	}
+	client := f.NewHTTPClient()
+
+	ctrl := &Controller{
+		cache:       *f.NewCache(),
+		consensuses: *f.NewConsensusCache(),
+		hostnames:   *f.NewHostnameCache(),
+		l2:          f.NewL2(),
+		peers:       f.NewPeers(),
+		gossip:      gossip,
+		hedger:      f.NewHedger(),
+		resolver:    f.NewResolver(client.client.Transport),
+		providers:   *providers,
+		client:      *client,
+		logger:      *f.NewLogger(),
+
+		refreshConf: f.Config.Cache.Refresh,
+		adminToken:  f.Config.Admin.Token,
+
+		gossipPeriod: f.Config.Cluster.GossipPeriod.Duration,
+		stateConf:    f.Config.State,
 	}
+	ctrl.batchers = ctrl.newBatchers()
+	return ctrl
 }
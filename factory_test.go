@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/searchinform/provider"
+)
+
+// testCert - certificate with its key signed by parent (self-signed if parent is nil)
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, template *x509.Certificate) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Key err:", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	signer := &testCert{cert: template, key: key}
+	if parent != nil {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal("Certificate err:", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("Certificate err:", err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes certificate & key as PEM files, returns their paths
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal("Key err:", err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal("Write err:", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal("Write err:", err)
+	}
+	return
+}
+
+func TestProviderHTTPClientTLS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newTestCert(t, "CA", nil, &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign})
+	server := newTestCert(t, "server", ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	client := newTestCert(t, "client", ca, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := client.write(t, dir, "client")
+
+	// provider requires client certificate signed by CA
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.der}, PrivateKey: server.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // rejected handshakes are expected
+	srv.StartTLS()
+	defer srv.Close()
+
+	cases := []struct {
+		Conf ProviderHTTPConfig
+		OK   bool
+	}{
+		{Conf: ProviderHTTPConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, OK: true},
+		{Conf: ProviderHTTPConfig{CAFile: caFile}},                       // no client certificate
+		{Conf: ProviderHTTPConfig{CertFile: certFile, KeyFile: keyFile}}, // unknown CA of provider
+	}
+	f := NewFactory(testConfig())
+	for i, testCase := range cases {
+		httpClient, err := f.NewProviderHTTPClient(&provider.Provider{MaxRate: 1}, &testCase.Conf)
+		if err != nil {
+			t.Fatalf("Case [%v]: client err: %v", i, err)
+		}
+		resp, err := httpClient.Get(srv.URL)
+		if err != nil {
+			if testCase.OK {
+				t.Fatalf("Case [%v]: request err: %v", i, err)
+			}
+			continue
+		}
+		resp.Body.Close()
+		if !testCase.OK {
+			t.Fatalf("Case [%v]: request must fail, but status %v", i, resp.Status)
+		}
+		if peer := resp.TLS.PeerCertificates[0].Subject.CommonName; peer != "server" {
+			t.Fatalf("Case [%v]: invalid server certificate `%v`", i, peer)
+		}
+	}
+}
+
+func TestProviderHTTPClientProxy(t *testing.T) {
+	t.Parallel()
+
+	var proxied int64
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host == "provider.invalid" {
+			atomic.AddInt64(&proxied, 1)
+		}
+		w.Write([]byte(`{"country":"Belarus"}`))
+	}))
+	defer proxy.Close()
+
+	client, err := NewFactory(testConfig()).NewProviderHTTPClient(&provider.Provider{MaxRate: 1}, &ProviderHTTPConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal("Client err:", err)
+	}
+	resp, err := client.Get("http://provider.invalid/1.2.3.4")
+	if err != nil {
+		t.Fatal("Request err:", err)
+	}
+	resp.Body.Close()
+	if atomic.LoadInt64(&proxied) != 1 {
+		t.Fatal("Request isn't sent through proxy")
+	}
+}
+
+func TestProviderHTTPClientNegative(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, keyFile := newTestCert(t, "client", nil, &x509.Certificate{}).write(t, dir, "client")
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal("Write err:", err)
+	}
+
+	f := NewFactory(testConfig())
+	for i, conf := range []ProviderHTTPConfig{
+		{Proxy: "ftp://proxy"},
+		{Proxy: "http://[::1"},
+		{KeyFile: keyFile},
+		{CertFile: keyFile, KeyFile: keyFile},
+		{CAFile: empty},
+		{CAFile: filepath.Join(dir, "missing.pem")},
+	} {
+		if _, err := f.NewProviderHTTPClient(&provider.Provider{MaxRate: 1}, &conf); err == nil {
+			t.Fatalf("Case [%v]: no error", i)
+		}
+	}
+}
+
+// writeConfig writes config to temporary file, returns its path
+func writeConfig(t *testing.T, conf string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "conf.json")
+	if err := os.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatal("Write err:", err)
+	}
+	return path
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	conf, err := ParseConfig(writeConfig(t, `{
+		"cluster": {"self": "http://a", "peers": ["http://a", "http://b"], "secret": "secret"},
+		"providers": [{"name": "a", "pattern": "http://a/%s", "scheme": ["country"], "max_rate": 1,
+			"batch": {"size": 10, "window": "10ms", "pattern": "http://a/batch"}}]
+	}`))
+	if err != nil || len(conf.Providers) != 1 || conf.Providers[0].Batch == nil {
+		t.Fatalf("Invalid config: %+v err: %v", conf, err)
+	}
+}
+
+func TestParseConfigNegative(t *testing.T) {
+	t.Parallel()
+
+	for i, conf := range []string{
+		// placeholders of sample config
+		`{"admin": {"token": "SomeAdminToken"}}`,
+		`{"cluster": {"self": "http://a", "peers": ["http://a", "http://b"], "secret": "SomePeerSecret"}}`,
+		// replica isn't in cluster
+		`{"cluster": {"self": "http://c", "peers": ["http://a", "http://b"], "secret": "secret"}}`,
+		`{"cluster": {"peers": ["http://a", "http://b"], "secret": "secret"}}`,
+		// batch calls with answers, which aren't JSON
+		`{"providers": [{"name": "a", "pattern": "http://a/%s", "format": "xml", "extract": "/a", "max_rate": 1,
+			"batch": {"size": 10, "window": "10ms", "pattern": "http://a/batch"}}]}`,
+		`{"providers": [{"name": "a", "pattern": "http://a/%s", "format": "regex", "regex": "(\\w+)", "max_rate": 1,
+			"batch": {"size": 10, "window": "10ms", "pattern": "http://a/batch"}}]}`,
+	} {
+		if _, err := ParseConfig(writeConfig(t, conf)); err == nil {
+			t.Fatalf("Case [%v]: no config error", i)
+		}
+	}
+}
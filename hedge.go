@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/searchinform/cache"
+	"github.com/searchinform/provider"
+)
+
+// Hedger - hedged requests to second provider, nil Hedger is disabled
+type Hedger struct {
+	quantile float64       // hedge is fired after this quantile of latency of primary provider
+	min      time.Duration // lower bound of hedge delay (delay if latency is still unknown)
+	budget   *provider.Budget
+}
+
+// NewHedger - constructor for Hedger struct
+func NewHedger(quantile float64, min time.Duration, budget float64) *Hedger {
+	return &Hedger{
+		quantile: quantile,
+		min:      min,
+		budget:   provider.NewBudget(budget),
+	}
+}
+
+// delay returns time to wait for answer of primary provider before hedge
+func (h *Hedger) delay(providers *provider.Iterator, primary *provider.Provider) time.Duration {
+	delay, ok := providers.Quantile(primary, h.quantile)
+	if !ok || delay < h.min {
+		return h.min
+	}
+	return delay
+}
+
+// answer of provider
+type answer struct {
+	provider *provider.Provider
+	country  string
+	origin   cache.Origin
+	err      error
+}
+
+// fetchFirst returns answer of primary provider or, if it's slow, first successful
+// answer of primary and hedged providers (the other request is cancelled)
+func (ctrl *Controller) fetchFirst(ctx context.Context, host, addr string, primary *provider.Provider) *answer {
+	if ctrl.hedger == nil {
+		country, origin, err := ctrl.fetch(ctx, primary, addr)
+		return &answer{provider: primary, country: country, origin: origin, err: err}
+	}
+	ctrl.hedger.budget.Request()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	answers := make(chan *answer, 2)
+	run := func(provider *provider.Provider) {
+		country, origin, err := ctrl.fetch(ctx, provider, addr)
+		answers <- &answer{provider: provider, country: country, origin: origin, err: err}
+	}
+	go run(primary)
+
+	timer := time.NewTimer(ctrl.hedger.delay(&ctrl.providers, primary))
+	defer timer.Stop()
+
+	select {
+	case ans := <-answers:
+		return ans
+	case <-ctx.Done(): // fetch returns error of cancelled request
+		return <-answers
+	case <-timer.C:
+	}
+
+	// budget isn't spent if there is no other provider
+	pending, counted := 1, time.Now().Unix()
+	if hedge, err := ctrl.providers.NextExceptAt(counted, primary); err == nil {
+		if ctrl.hedger.budget.Allow() {
+			ctrl.logger.Printf("Resolve [%v]: addr [%v]: provider [%v] is slow, hedge to provider [%v]",
+				host, addr, primary.Name, hedge.Name)
+			go run(hedge)
+			pending++
+		} else {
+			ctrl.providers.Release(hedge, counted)
+		}
+	}
+
+	var ans *answer
+	for ; pending > 0; pending-- {
+		if ans = <-answers; ans.err == nil {
+			return ans
+		}
+	}
+	return ans
+}
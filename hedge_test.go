@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newHedgeController returns controller with hedged requests from primary stub to secondary one
+func newHedgeController(t *testing.T, budget float64, primary, secondary *stub) *Controller {
+	t.Helper()
+
+	conf := testConfig(primary, secondary)
+	conf.Hedge = HedgeConfig{Quantile: 0.9, MinDelay: Duration{50 * time.Millisecond}, Budget: budget}
+	return newTestController(t, conf)
+}
+
+// waitFor polls condition until timeout
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition isn't met until timeout")
+		}
+	}
+}
+
+func TestFetchFirstPrimary(t *testing.T) {
+	t.Parallel()
+
+	primary, secondary := newStub(t, "Primaryland", 0), newStub(t, "Secondland", 0)
+	ctrl := newHedgeController(t, 1, primary, secondary)
+
+	ans := ctrl.fetchFirst(context.Background(), "host", "1.2.3.4", ctrl.providers.Providers()[0])
+	if ans.err != nil || ans.country != "Primaryland" {
+		t.Fatalf("Invalid answer: %+v", ans)
+	}
+	// no hedge before delay
+	if time.Sleep(100 * time.Millisecond); secondary.Requests() != 0 {
+		t.Fatalf("Hedge is sent to fast provider: %v requests", secondary.Requests())
+	}
+}
+
+func TestFetchFirstHedge(t *testing.T) {
+	t.Parallel()
+
+	primary, secondary := newStub(t, "Primaryland", 5*time.Second), newStub(t, "Secondland", 0)
+	ctrl := newHedgeController(t, 1, primary, secondary)
+
+	start := time.Now()
+	ans := ctrl.fetchFirst(context.Background(), "host", "1.2.3.4", ctrl.providers.Providers()[0])
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("Hedge must be fired after delay, but answer in %v", elapsed)
+	}
+	if ans.err != nil || ans.country != "Secondland" || ans.provider.Name != secondary.URL {
+		t.Fatalf("Invalid answer: %+v", ans)
+	}
+
+	// winner cancels slow request
+	waitFor(t, func() bool { return primary.Cancelled() == 1 })
+	if requests, extra := ctrl.hedger.budget.Used(); requests != 1 || extra != 1 {
+		t.Fatalf("Invalid usage of budget: requests %v, extra %v", requests, extra)
+	}
+}
+
+func TestFetchFirstBudget(t *testing.T) {
+	t.Parallel()
+
+	primary, secondary := newStub(t, "Primaryland", 200*time.Millisecond), newStub(t, "Secondland", 0)
+	ctrl := newHedgeController(t, 0.5, primary, secondary)
+
+	// budget is exhausted, so slow primary answers
+	ans := ctrl.fetchFirst(context.Background(), "host", "1.2.3.4", ctrl.providers.Providers()[0])
+	if ans.err != nil || ans.country != "Primaryland" {
+		t.Fatalf("Invalid answer: %+v", ans)
+	}
+	if secondary.Requests() != 0 || primary.Cancelled() != 0 {
+		t.Fatalf("Hedge without budget: %v requests", secondary.Requests())
+	}
+	// request isn't counted for provider of hedge
+	if rate := ctrl.providers.Stats()[1].Rate; rate != 0 {
+		t.Fatalf("Rate of provider of hedge without budget: %v", rate)
+	}
+}
+
+func TestFetchFirstSingleProvider(t *testing.T) {
+	t.Parallel()
+
+	primary := newStub(t, "Primaryland", 200*time.Millisecond)
+	conf := testConfig(primary)
+	conf.Hedge = HedgeConfig{Quantile: 0.9, MinDelay: Duration{50 * time.Millisecond}, Budget: 1}
+	ctrl := newTestController(t, conf)
+
+	// there is no provider of hedge, so budget isn't spent
+	ans := ctrl.fetchFirst(context.Background(), "host", "1.2.3.4", ctrl.providers.Providers()[0])
+	if ans.err != nil || ans.country != "Primaryland" {
+		t.Fatalf("Invalid answer: %+v", ans)
+	}
+	if requests, extra := ctrl.hedger.budget.Used(); requests != 1 || extra != 0 {
+		t.Fatalf("Invalid usage of budget: requests %v, extra %v", requests, extra)
+	}
+}
+
+func TestFetchFirstCancel(t *testing.T) {
+	t.Parallel()
+
+	primary, secondary := newStub(t, "Primaryland", 5*time.Second), newStub(t, "Secondland", 5*time.Second)
+	ctrl := newHedgeController(t, 1, primary, secondary)
+
+	// cancelled client stops both requests
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if ans := ctrl.fetchFirst(ctx, "host", "1.2.3.4", ctrl.providers.Providers()[0]); ans.err == nil {
+		t.Fatalf("Answer of cancelled request: %+v", ans)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Cancelled request answers in %v", elapsed)
+	}
+	waitFor(t, func() bool { return primary.Cancelled() == 1 && secondary.Cancelled() == 1 })
+}
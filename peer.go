@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/searchinform/cache"
+	"github.com/searchinform/cluster"
+)
+
+// Peers - replicas in consistent-hash ring, nil Peers is disabled cluster
+type Peers struct {
+	ring   *cluster.Ring
+	self   string
+	secret string
+	client *http.Client
+}
+
+// NewPeers - constructor for Peers struct
+func NewPeers(ring *cluster.Ring, self, secret string, client *http.Client) *Peers {
+	return &Peers{
+		ring:   ring,
+		self:   self,
+		secret: secret,
+		client: client,
+	}
+}
+
+// Owner returns owner of addr, if owner is another replica
+func (p *Peers) Owner(addr string) (owner string, remote bool) {
+	if p == nil {
+		return "", false
+	}
+	owner = p.ring.Owner(addr)
+	return owner, owner != "" && owner != p.self
+}
+
+// Authorized checks that request has been forwarded by peer
+func (p *Peers) Authorized(r *http.Request) bool {
+	if p == nil || p.secret == "" {
+		return false
+	}
+	secret, ok := r.Header[http.CanonicalHeaderKey(cluster.Header)]
+	return ok && len(secret) == 1 && subtle.ConstantTimeCompare([]byte(secret[0]), []byte(p.secret)) == 1
+}
+
+// Resolve forwards resolving of addr to owner (with remaining time of ctx),
+// returns answer with its remaining TTL in cache of owner (zero if it's unknown)
+func (p *Peers) Resolve(ctx context.Context, owner, addr string) (country string, origin cache.Origin, ttl time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, owner+"/internal/resolve?"+url.Values{"addr": {addr}}.Encode(), nil)
+	if err != nil {
+		return "", origin, 0, err
+	}
+	req.Header.Set(cluster.Header, p.secret)
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(TimeoutHeader, time.Until(deadline).String())
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", origin, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", origin, 0, errors.New("Invalid status code:" + resp.Status)
+	}
+
+	var rec record
+	if err := json.NewDecoder(resp.Body).Decode(&rec); err != nil {
+		return "", origin, 0, err
+	}
+	origin = cache.Origin{Provider: rec.Provider, Fetched: rec.Fetched, Latency: rec.Latency}
+	if rec.TTL > 0 {
+		// TTL is measured by owner after start of request
+		ttl = rec.TTL - time.Since(start)
+	}
+	return rec.Country, origin, ttl, nil
+}
+
+// PeerResolve resolves addr forwarded by peer (without further forwarding)
+func (ctrl *Controller) PeerResolve(w http.ResponseWriter, r *http.Request) {
+	if !ctrl.peers.Authorized(r) {
+		ctrl.error(w, "Peer resolve: unauthorized request from "+r.RemoteAddr, http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel, err := requestContext(r)
+	if err != nil {
+		ctrl.error(w, "Peer resolve err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	addr := r.FormValue("addr")
+	res, err := ctrl.resolveAddr(ctx, addr, addr, false)
+	if err != nil {
+		ctrl.error(w, "Peer resolve err: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	rec := &record{
+		Country:  res.Country,
+		Provider: res.Origin.Provider,
+		Fetched:  res.Origin.Fetched,
+		Latency:  res.Origin.Latency,
+	}
+	// every answer of owner is in its cache, so peer doesn't keep it longer
+	if entry, ok := ctrl.cache.Peek(addr); ok {
+		rec.TTL = time.Until(time.Unix(0, entry.Deadline()))
+	}
+	json.NewEncoder(w).Encode(rec)
+}
+
+// PeerRates receives provider request counts of peer
+func (ctrl *Controller) PeerRates(w http.ResponseWriter, r *http.Request) {
+	if ctrl.gossip == nil || r.Method != http.MethodPost {
+		ctrl.error(w, "Peer rates: gossip is disabled or invalid method "+r.Method, http.StatusNotFound)
+		return
+	}
+	if err := ctrl.gossip.Decode(w, r); err != nil {
+		ctrl.error(w, "Peer rates err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
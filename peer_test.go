@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/searchinform/cache"
+	"github.com/searchinform/cluster"
+)
+
+// newTestCluster returns controllers of replicas, every replica has own provider with its country
+func newTestCluster(t *testing.T, secret string, countries ...string) ([]*Controller, []*stub, []string) {
+	t.Helper()
+
+	var (
+		ctrls    = make([]*Controller, len(countries))
+		stubs    = make([]*stub, len(countries))
+		handlers = make([]http.Handler, len(countries))
+		urls     []string
+	)
+	for i := range countries {
+		i := i
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		urls = append(urls, srv.URL)
+	}
+
+	for i, country := range countries {
+		stubs[i] = newStub(t, country, 0)
+		conf := testConfig(stubs[i])
+		conf.Cluster.Self, conf.Cluster.Peers, conf.Cluster.Secret = urls[i], urls, secret
+		conf.Cluster.Replicas, conf.Cluster.Timeout = 16, Duration{time.Second}
+		ctrls[i] = newTestController(t, conf)
+
+		router := http.NewServeMux()
+		router.HandleFunc("/internal/resolve", ctrls[i].PeerResolve)
+		handlers[i] = router
+	}
+	return ctrls, stubs, urls
+}
+
+func TestPeerForward(t *testing.T) {
+	t.Parallel()
+
+	ctrls, stubs, urls := newTestCluster(t, "secret", "Firstland", "Secondland")
+
+	// addr owned by the second replica
+	var addr string
+	for i := 0; addr == ""; i++ {
+		if candidate := "10.0.0." + strconv.Itoa(i); ctrls[0].peers.ring.Owner(candidate) == urls[1] {
+			addr = candidate
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := ctrls[0].resolveAddr(context.Background(), addr, addr, true)
+		if err != nil || res.Country != "Secondland" {
+			t.Fatalf("Invalid answer: %+v err: %v", res, err)
+		}
+		if expected := []string{tierPeer, tierL1}[i]; res.Tier != expected {
+			t.Fatalf("Tier of answer [%v]: expected: %v, but %v", i, expected, res.Tier)
+		}
+	}
+	if stubs[0].Requests() != 0 || stubs[1].Requests() != 1 {
+		t.Fatalf("Only owner must request provider once, but %v & %v requests", stubs[0].Requests(), stubs[1].Requests())
+	}
+}
+
+func TestPeerForwardTTL(t *testing.T) {
+	t.Parallel()
+
+	ctrls, _, urls := newTestCluster(t, "secret", "Firstland", "Secondland")
+
+	var addr string
+	for i := 0; addr == ""; i++ {
+		if candidate := "10.0.0." + strconv.Itoa(i); ctrls[0].peers.ring.Owner(candidate) == urls[1] {
+			addr = candidate
+		}
+	}
+
+	// answer expires soon in cache of owner
+	ctrls[1].cache.InsertWithTTL(addr, "Secondland", cache.Origin{Provider: "p"}, 10*time.Second)
+	owned, _ := ctrls[1].cache.Peek(addr)
+
+	res, err := ctrls[0].resolveAddr(context.Background(), addr, addr, true)
+	if err != nil || res.Country != "Secondland" || res.Tier != tierPeer {
+		t.Fatalf("Invalid answer: %+v err: %v", res, err)
+	}
+	entry, ok := ctrls[0].cache.Peek(addr)
+	if !ok || entry.Deadline() > owned.Deadline() || entry.Deadline() < owned.Deadline()-int64(time.Second) {
+		t.Fatalf("Answer of peer must expire with answer of owner in %v, but in %v",
+			time.Until(time.Unix(0, owned.Deadline())), time.Until(time.Unix(0, entry.Deadline())))
+	}
+}
+
+func TestPeerForwardFallback(t *testing.T) {
+	t.Parallel()
+
+	ctrls, stubs, urls := newTestCluster(t, "secret", "Firstland", "Secondland")
+	ctrls[0].peers.secret = "wrong"
+
+	var addr string
+	for i := 0; addr == ""; i++ {
+		if candidate := "10.0.0." + strconv.Itoa(i); ctrls[0].peers.ring.Owner(candidate) == urls[1] {
+			addr = candidate
+		}
+	}
+
+	// owner rejects request, so addr is resolved locally
+	res, err := ctrls[0].resolveAddr(context.Background(), addr, addr, true)
+	if err != nil || res.Country != "Firstland" || res.Tier != "" {
+		t.Fatalf("Invalid answer: %+v err: %v", res, err)
+	}
+	if stubs[0].Requests() != 1 || stubs[1].Requests() != 0 {
+		t.Fatalf("Only local provider must be requested, but %v & %v requests", stubs[0].Requests(), stubs[1].Requests())
+	}
+}
+
+func TestPeerResolveUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	for _, secret := range []string{"secret", ""} {
+		ctrls, stubs, _ := newTestCluster(t, secret, "Firstland")
+		for _, header := range []string{"", "wrong", "secret"} {
+			if header == secret {
+				continue
+			}
+			req := httptest.NewRequest(http.MethodGet, "/internal/resolve?addr=1.2.3.4", nil)
+			if header != "" {
+				req.Header.Set(cluster.Header, header)
+			}
+			w := httptest.NewRecorder()
+			ctrls[0].PeerResolve(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("Secret [%v], header [%v]: expected: %v, but %v", secret, header, http.StatusUnauthorized, w.Code)
+			}
+		}
+		if stubs[0].Requests() != 0 {
+			t.Fatalf("Secret [%v]: unauthorized request mustn't request provider", secret)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// accounting rules of batch calls
+const (
+	AccountingCall = "call" // batch call is one request (default)
+	AccountingIP   = "ip"   // every IP of batch call is one request
+)
+
+// Batch - settings of calls with several IPs (JSON answers only), pattern, headers & body
+// are templates with {{.IPs}}
+type Batch struct {
+	Size        int               `json:"size"`   // max number of IPs per call
+	Window      string            `json:"window"` // time to accumulate IPs, e.g. "10ms"
+	Accounting  string            `json:"accounting"`
+	Method      string            `json:"method"`
+	URLPattern  string            `json:"pattern"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body"`
+	ContentType string            `json:"content_type"`
+
+	// path to answers (each of them is parsed by extract & fail_if of provider):
+	// array in order of IPs or object with IPs as keys
+	Items string `json:"items"`
+
+	window  time.Duration // compiled by compile
+	request *request
+	items   *Expr
+}
+
+func (b *Batch) compile() (err error) {
+	if b.Size < 1 {
+		return errors.New("batch size must be positive")
+	}
+	if b.window, err = time.ParseDuration(b.Window); err != nil {
+		return errors.New("batch window err : " + err.Error())
+	}
+	switch b.Accounting {
+	case "", AccountingCall, AccountingIP:
+	default:
+		return errors.New("unknown batch accounting `" + b.Accounting + "`")
+	}
+
+	if b.request, err = b.newRequest(); err != nil {
+		return err
+	}
+
+	items := b.Items
+	if items == "" {
+		items = "$"
+	}
+	b.items, err = CompileExpr(items)
+	return err
+}
+
+// newRequest returns compiled request of batch call
+func (b *Batch) newRequest() (*request, error) {
+	method := b.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	return newRequest(&Provider{
+		Method:      method,
+		URLPattern:  b.URLPattern,
+		Headers:     b.Headers,
+		Body:        b.Body,
+		ContentType: b.ContentType,
+	})
+}
+
+// Duration returns window to accumulate IPs
+func (b *Batch) Duration() time.Duration {
+	return b.window
+}
+
+// PerIP returns true if every IP of batch call is one request
+func (b *Batch) PerIP() bool {
+	return b.Accounting == AccountingIP
+}
+
+// Answer - country of IP or error of its extraction
+type Answer struct {
+	Country string
+	Err     error
+}
+
+// NewBatchRequest returns batch request to provider about addrs (provider must be compiled)
+func (p *Provider) NewBatchRequest(ctx context.Context, addrs []string) (*http.Request, error) {
+	return p.Batch.request.build(ctx, &Vars{IPs: addrs, Lang: p.Lang, APIKey: p.APIKey})
+}
+
+// ParseBatch returns answers about addrs (in the same order) from body of batch call
+func (p *Provider) ParseBatch(r io.Reader, addrs []string) ([]Answer, error) {
+	data, err := decodeJSON(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = p.Batch.items.eval(data); err != nil {
+		return nil, errors.New("Invalid batch body: " + err.Error())
+	}
+
+	answers := make([]Answer, len(addrs))
+	switch items := data.(type) {
+	case []interface{}:
+		if len(items) != len(addrs) {
+			return nil, errors.New("Invalid batch body: " + strconv.Itoa(len(items)) +
+				" answers for " + strconv.Itoa(len(addrs)) + " IPs")
+		}
+		for i := range items {
+			answers[i].Country, answers[i].Err = p.parser.eval(items[i])
+		}
+	case map[string]interface{}:
+		for i, addr := range addrs {
+			item, ok := items[addr]
+			if !ok {
+				answers[i].Err = errors.New("Invalid batch body: no answer for " + addr)
+				continue
+			}
+			answers[i].Country, answers[i].Err = p.parser.eval(item)
+		}
+	default:
+		return nil, errors.New("Invalid batch body: answers must be array or object")
+	}
+	return answers, nil
+}
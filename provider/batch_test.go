@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderBatch(t *testing.T) {
+	t.Parallel()
+
+	provider := &Provider{
+		URLPattern: "http://host/json/%s",
+		Extract:    `$.country`,
+		FailIf:     []string{`$.status == 'fail'`},
+		Batch: &Batch{
+			Size:        100,
+			Window:      "10ms",
+			URLPattern:  "http://host/batch?lang={{.Lang}}",
+			Body:        "{{json .IPs}}",
+			ContentType: "application/json",
+		},
+		Lang: "en",
+	}
+	if err := provider.Compile(); err != nil {
+		t.Fatal("Compile err:", err)
+	}
+
+	addrs := []string{"1.2.3.4", "10.0.0.1"}
+	req, err := provider.NewBatchRequest(context.Background(), addrs)
+	if err != nil {
+		t.Fatal("Request err:", err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if req.Method != "POST" || req.URL.String() != "http://host/batch?lang=en" || string(body) != `["1.2.3.4","10.0.0.1"]` {
+		t.Fatalf("Invalid request: %v %v %s", req.Method, req.URL, body)
+	}
+
+	answers, err := provider.ParseBatch(strings.NewReader(`[{"country":"Belarus"},{"status":"fail"}]`), addrs)
+	if err != nil || len(answers) != 2 || answers[0].Country != "Belarus" || answers[0].Err != nil || answers[1].Err == nil {
+		t.Fatalf("Invalid answers: %+v err: %v", answers, err)
+	}
+	if _, err := provider.ParseBatch(strings.NewReader(`[{"country":"Belarus"}]`), addrs); err == nil {
+		t.Fatal("No error of missing answers")
+	}
+
+	provider.Batch.Items = "$.data"
+	if err := provider.Compile(); err != nil {
+		t.Fatal("Compile err:", err)
+	}
+	answers, err = provider.ParseBatch(strings.NewReader(`{"data":{"10.0.0.1":{"country":"Russia"}}}`), addrs)
+	if err != nil || answers[0].Err == nil || answers[1].Country != "Russia" {
+		t.Fatalf("Invalid answers: %+v err: %v", answers, err)
+	}
+	if _, err := provider.ParseBatch(strings.NewReader(`{"data":"Belarus"}`), addrs); err == nil {
+		t.Fatal("No error of invalid answers")
+	}
+	if provider.Batch.PerIP() {
+		t.Fatal("Batch call must be one request by default")
+	}
+}
+
+func TestBatchKeys(t *testing.T) {
+	t.Parallel()
+
+	provider := Provider{
+		Name:       "pool",
+		URLPattern: "http://host/{{.IP}}",
+		MaxRate:    10,
+		Batch: &Batch{
+			Size:       100,
+			Window:     "10ms",
+			URLPattern: "http://host/batch?key={{.APIKey}}",
+			Headers:    map[string]string{"Authorization": "Token Default", "Accept": "application/json"},
+			Body:       "{{json .IPs}}",
+		},
+		Keys: []Key{
+			{Name: "a", APIKey: "keyA"},
+			{Name: "b", APIKey: "keyB", Headers: map[string]string{"Authorization": "Token B"}},
+		},
+	}
+	if err := provider.Compile(); err != nil {
+		t.Fatal("Compile err:", err)
+	}
+
+	iter := NewIterator([]Provider{provider})
+	cases := []struct {
+		Key           string
+		URL           string
+		Authorization string
+	}{
+		{Key: "a", URL: "http://host/batch?key=keyA", Authorization: "Token Default"},
+		{Key: "b", URL: "http://host/batch?key=keyB", Authorization: "Token B"},
+	}
+	for i, testCase := range cases {
+		p := &iter.blocks[i].provider
+		req, err := p.NewBatchRequest(context.Background(), []string{"1.2.3.4"})
+		if err != nil || p.Key != testCase.Key {
+			t.Fatalf("Key [%v]: request err: %v", p.Key, err)
+		}
+		if req.URL.String() != testCase.URL || req.Header.Get("Authorization") != testCase.Authorization ||
+			req.Header.Get("Accept") != "application/json" {
+			t.Fatalf("Key [%v]: invalid request: %v %v", p.Key, req.URL, req.Header)
+		}
+	}
+
+	// batch settings of provider itself aren't changed by keys
+	if provider.Batch.Headers["Authorization"] != "Token Default" || iter.blocks[0].provider.Batch == iter.blocks[1].provider.Batch {
+		t.Fatalf("Batch settings are shared by keys: %v", provider.Batch.Headers)
+	}
+}
+
+func TestBatchCompileNegative(t *testing.T) {
+	t.Parallel()
+
+	batches := []Batch{
+		{Size: 0, Window: "10ms"},
+		{Size: 10, Window: "10"},
+		{Size: 10, Window: "10ms", Accounting: "byte"},
+		{Size: 10, Window: "10ms", Body: "{{json .IPs"},
+		{Size: 10, Window: "10ms", Items: "data"},
+	}
+	for i := range batches {
+		provider := &Provider{Batch: &batches[i]}
+		if err := provider.Compile(); err == nil {
+			t.Fatalf("Case [%v]: no compile error", i)
+		}
+	}
+
+	// answers of batch calls are always decoded as JSON
+	for _, format := range []string{FormatXML, FormatText, FormatRegex} {
+		provider := &Provider{Format: format, Delimiter: ";", Regex: `(\w+)`}
+		if err := provider.Compile(); err != nil {
+			t.Fatalf("Format [%v]: compile err: %v", format, err)
+		}
+		provider.Batch = &Batch{Size: 10, Window: "10ms"}
+		if err := provider.Compile(); err == nil {
+			t.Fatalf("Format [%v]: no compile error", format)
+		}
+	}
+}
+
+func TestIterRelease(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{{URLPattern: "host0", MaxRate: 1}})
+	now := time.Now().Unix()
+	provider, err := iter.NextAt(now)
+	if err != nil {
+		t.Fatal("Iterator err:", err)
+	}
+	iter.Release(provider, now)
+	if provider, err := iter.NextAt(now); err != nil {
+		t.Fatalf("Released request isn't returned: %v err: %v", provider, err)
+	}
+
+	// request is released in the second, in which it's counted
+	iter.Release(provider, now)
+	if rate := iter.blocks[0].rate.rate(now + 1); rate != 0 {
+		t.Fatalf("Invalid rate in the next second: %v", rate)
+	}
+	for i, count := range iter.blocks[0].rate.history(now + 1) {
+		if count < 0 {
+			t.Fatalf("Negative count [%v]: %v", i, count)
+		}
+	}
+	if providers := iter.Providers(); len(providers) != 1 || providers[0] != provider {
+		t.Fatalf("Invalid providers: %v", providers)
+	}
+}
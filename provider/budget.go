@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget - cap of extra requests (e.g. hedges) as fraction of primary requests for the last minute,
+// counts are kept in ring of per-second buckets
+type Budget struct {
+	fraction float64
+
+	mu      sync.Mutex
+	buckets [nquants]bucket
+}
+
+// bucket - counts of requests for one second
+type bucket struct {
+	second   int64 // unix time
+	requests int64
+	extra    int64
+}
+
+// NewBudget - constructor for Budget struct
+func NewBudget(fraction float64) *Budget {
+	return &Budget{fraction: fraction}
+}
+
+// bucket returns bucket of this second, it's reset if it holds counts of older second
+func (b *Budget) bucket(now int64) *bucket {
+	bucket := &b.buckets[now%nquants]
+	if bucket.second != now {
+		bucket.second, bucket.requests, bucket.extra = now, 0, 0
+	}
+	return bucket
+}
+
+// sum returns number of primary and extra requests for the last minute
+func (b *Budget) sum(now int64) (requests, extra int64) {
+	for i := range b.buckets {
+		if bucket := &b.buckets[i]; now-nquants < bucket.second && bucket.second <= now {
+			requests += bucket.requests
+			extra += bucket.extra
+		}
+	}
+	return
+}
+
+func (b *Budget) request(now int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bucket(now).requests++
+}
+
+func (b *Budget) allow(now int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	requests, extra := b.sum(now)
+	if float64(extra+1) > b.fraction*float64(requests) {
+		return false
+	}
+	b.bucket(now).extra++
+	return true
+}
+
+func (b *Budget) used(now int64) (requests, extra int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.sum(now)
+}
+
+// Request registers primary request
+func (b *Budget) Request() {
+	b.request(time.Now().Unix())
+}
+
+// Allow takes one extra request from budget, returns false if budget is exhausted
+func (b *Budget) Allow() bool {
+	return b.allow(time.Now().Unix())
+}
+
+// Used returns number of primary and extra requests for the last minute
+func (b *Budget) Used() (requests, extra int64) {
+	return b.used(time.Now().Unix())
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestBudget(t *testing.T) {
+	t.Parallel()
+
+	budget := NewBudget(0.05)
+	if budget.Allow() {
+		t.Fatal("Extra request is allowed without primary requests")
+	}
+
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		budget.Request()
+		if budget.Allow() {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("Invalid number of extra requests: expected: %v, but %v", 5, allowed)
+	}
+	if requests, extra := budget.Used(); requests != 100 || extra != 5 {
+		t.Fatalf("Invalid usage: requests %v, extra %v", requests, extra)
+	}
+}
+
+func TestBudgetWindow(t *testing.T) {
+	t.Parallel()
+
+	const now = 1000
+	budget := NewBudget(0.5)
+	for i := 0; i < 4; i++ {
+		budget.request(now)
+	}
+	if !budget.allow(now+1) || !budget.allow(now+2) || budget.allow(now+3) {
+		t.Fatal("Budget must allow 2 extra requests")
+	}
+
+	// primary requests of the last minute only
+	if budget.allow(now + nquants - 1) {
+		t.Fatal("Budget is exhausted within minute")
+	}
+	if requests, extra := budget.used(now + nquants); requests != 0 || extra != 2 {
+		t.Fatalf("Invalid usage after minute: requests %v, extra %v", requests, extra)
+	}
+	if budget.allow(now + nquants) {
+		t.Fatal("Extra request is allowed without primary requests of the last minute")
+	}
+
+	// old counts don't exhaust budget
+	for i := 0; i < 2; i++ {
+		budget.request(now + 2*nquants)
+	}
+	if !budget.allow(now + 2*nquants) {
+		t.Fatal("Budget is exhausted by old extra requests")
+	}
+	if requests, extra := budget.used(now + 2*nquants); requests != 2 || extra != 1 {
+		t.Fatalf("Invalid usage: requests %v, extra %v", requests, extra)
+	}
+}
@@ -0,0 +1,341 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// transforms of extracted value
+var transforms = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// segment - step of path: field name or array index (negative index counts from the end)
+type segment struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// path - JSONPath subset: $.field, $['field'], $[index]
+type path []segment
+
+func (p path) eval(value interface{}) (interface{}, error) {
+	for _, seg := range p {
+		if seg.isIndex {
+			array, ok := value.([]interface{})
+			if !ok {
+				return nil, errors.New("value isn't array for index " + strconv.Itoa(seg.index))
+			}
+			index := seg.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index < 0 || len(array) <= index {
+				return nil, errors.New("index " + strconv.Itoa(seg.index) + " is out of range")
+			}
+			value = array[index]
+			continue
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("value isn't object for field `" + seg.name + "`")
+		}
+		if value, ok = object[seg.name]; !ok {
+			return nil, errors.New("field `" + seg.name + "` not found")
+		}
+	}
+	return value, nil
+}
+
+// alternative - path with transforms of its value
+type alternative struct {
+	path       path
+	transforms []func(string) string
+}
+
+// Expr - compiled extraction expression:
+//
+//	expr        = alternative *( "||" alternative )
+//	alternative = path *( "|" ( "lower" / "upper" / "trim" ) )
+//	path        = "$" *( "." name / "[" index "]" / "['" name "']" ) / xpath
+//	xpath       = 1*( "/" name [ "[" position "]" ] ) [ "/@" name ]
+//
+// e.g. `$.data[0].country || $.country_name | upper` or `/geoPlugin/countryName` for XML
+type Expr struct {
+	src          string
+	alternatives []alternative
+}
+
+// CompileExpr parses extraction expression
+func CompileExpr(src string) (*Expr, error) {
+	sc := &scanner{src: src}
+	expr := &Expr{src: src}
+	for {
+		p, err := sc.path()
+		if err != nil {
+			return nil, err
+		}
+		alt := alternative{path: p}
+		for sc.skip(); sc.peek("|") && !sc.peek("||"); sc.skip() {
+			sc.pos++
+			sc.skip()
+			name := sc.ident()
+			transform, ok := transforms[name]
+			if !ok {
+				return nil, sc.error("unknown transform `" + name + "`")
+			}
+			alt.transforms = append(alt.transforms, transform)
+		}
+		expr.alternatives = append(expr.alternatives, alt)
+
+		if !sc.peek("||") {
+			break
+		}
+		sc.pos += 2
+	}
+	if !sc.end() {
+		return nil, sc.error("unexpected `" + sc.src[sc.pos:] + "`")
+	}
+	return expr, nil
+}
+
+// pathExpr returns expression of list of object keys (legacy scheme)
+func pathExpr(scheme []string) *Expr {
+	src, p := "$", make(path, 0, len(scheme))
+	for _, name := range scheme {
+		src += "['" + name + "']"
+		p = append(p, segment{name: name})
+	}
+	return &Expr{src: src, alternatives: []alternative{{path: p}}}
+}
+
+// eval returns value of first alternative, which can be evaluated
+func (e *Expr) eval(value interface{}) (v interface{}, err error) {
+	for _, alt := range e.alternatives {
+		if v, err = alt.path.eval(value); err == nil {
+			return v, nil
+		}
+	}
+	return nil, errors.New("`" + e.src + "`: " + err.Error())
+}
+
+// Eval returns value of first alternative, which is non-empty string
+func (e *Expr) Eval(value interface{}) (string, error) {
+	var err error
+	for _, alt := range e.alternatives {
+		var v interface{}
+		if v, err = alt.path.eval(value); err != nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			err = errors.New("value isn't string")
+			continue
+		}
+		for _, transform := range alt.transforms {
+			s = transform(s)
+		}
+		if s != "" {
+			return s, nil
+		}
+		err = errors.New("value is empty")
+	}
+	return "", errors.New("Invalid body: `" + e.src + "`: " + err.Error())
+}
+
+// String returns source of expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Cond - compiled condition: path ( "==" / "!=" ) literal, where literal is
+// JSON value or single-quoted string, e.g. `$.status == 'fail'`
+// (missing field isn't equal to any literal)
+type Cond struct {
+	src     string
+	path    path
+	equal   bool
+	literal interface{}
+}
+
+// CompileCond parses condition
+func CompileCond(src string) (*Cond, error) {
+	sc := &scanner{src: src}
+	p, err := sc.path()
+	if err != nil {
+		return nil, err
+	}
+
+	cond := &Cond{src: src, path: p}
+	switch sc.skip(); {
+	case sc.peek("=="):
+		cond.equal = true
+	case sc.peek("!="):
+	default:
+		return nil, sc.error("expected `==` or `!=`")
+	}
+	sc.pos += 2
+	sc.skip()
+
+	literal := strings.TrimSpace(sc.src[sc.pos:])
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		cond.literal = literal[1 : len(literal)-1]
+	} else if err := json.Unmarshal([]byte(literal), &cond.literal); err != nil {
+		return nil, sc.error("invalid literal `" + literal + "`")
+	}
+	if !scalar(cond.literal) {
+		return nil, sc.error("literal `" + literal + "` isn't scalar")
+	}
+	return cond, nil
+}
+
+func scalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, float64, bool:
+		return true
+	}
+	return false
+}
+
+// Match returns true if condition is satisfied by value
+func (c *Cond) Match(value interface{}) bool {
+	v, err := c.path.eval(value)
+	equal := err == nil && scalar(v) && v == c.literal
+	return equal == c.equal
+}
+
+// String returns source of condition
+func (c *Cond) String() string {
+	return c.src
+}
+
+// scanner of expressions
+type scanner struct {
+	src string
+	pos int
+}
+
+func (sc *scanner) error(msg string) error {
+	return errors.New("Expression `" + sc.src + "`: position " + strconv.Itoa(sc.pos) + ": " + msg)
+}
+
+func (sc *scanner) skip() {
+	for sc.pos < len(sc.src) && sc.src[sc.pos] == ' ' {
+		sc.pos++
+	}
+}
+
+func (sc *scanner) end() bool {
+	sc.skip()
+	return sc.pos == len(sc.src)
+}
+
+func (sc *scanner) peek(token string) bool {
+	return strings.HasPrefix(sc.src[sc.pos:], token)
+}
+
+func (sc *scanner) ident() string {
+	start := sc.pos
+	for sc.pos < len(sc.src) {
+		c := sc.src[sc.pos]
+		if c != '_' && c != '-' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			break
+		}
+		sc.pos++
+	}
+	return sc.src[start:sc.pos]
+}
+
+func (sc *scanner) path() (path, error) {
+	if sc.skip(); sc.peek("/") {
+		return sc.xpath()
+	}
+	if !sc.peek("$") {
+		return nil, sc.error("path must start with `$` or `/`")
+	}
+	sc.pos++
+
+	var p path
+	for {
+		switch {
+		case sc.peek("."):
+			sc.pos++
+			name := sc.ident()
+			if name == "" {
+				return nil, sc.error("expected field name")
+			}
+			p = append(p, segment{name: name})
+		case sc.peek("['"):
+			sc.pos += 2
+			end := strings.Index(sc.src[sc.pos:], "']")
+			if end < 0 {
+				return nil, sc.error("expected `']`")
+			}
+			p = append(p, segment{name: sc.src[sc.pos : sc.pos+end]})
+			sc.pos += end + 2
+		case sc.peek("["):
+			sc.pos++
+			end := strings.Index(sc.src[sc.pos:], "]")
+			if end < 0 {
+				return nil, sc.error("expected `]`")
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(sc.src[sc.pos : sc.pos+end]))
+			if err != nil {
+				return nil, sc.error("invalid index `" + sc.src[sc.pos:sc.pos+end] + "`")
+			}
+			p = append(p, segment{index: index, isIndex: true})
+			sc.pos += end + 1
+		default:
+			return p, nil
+		}
+	}
+}
+
+// xpath parses XPath-like path of decoded XML: /element/element[position]/@attribute,
+// text of element is value of path, which ends with element
+func (sc *scanner) xpath() (path, error) {
+	var p path
+	for sc.peek("/") {
+		sc.pos++
+		if sc.peek("@") {
+			sc.pos++
+			name := sc.ident()
+			if name == "" {
+				return nil, sc.error("expected attribute name")
+			}
+			if sc.peek("/") {
+				return nil, sc.error("attribute must be the last step")
+			}
+			return append(p, segment{name: "@" + name}), nil
+		}
+
+		name := sc.ident()
+		if name == "" {
+			return nil, sc.error("expected element name")
+		}
+		position := 1
+		if sc.peek("[") {
+			sc.pos++
+			end := strings.Index(sc.src[sc.pos:], "]")
+			if end < 0 {
+				return nil, sc.error("expected `]`")
+			}
+			var err error
+			if position, err = strconv.Atoi(strings.TrimSpace(sc.src[sc.pos : sc.pos+end])); err != nil || position < 1 {
+				return nil, sc.error("invalid position `" + sc.src[sc.pos:sc.pos+end] + "`")
+			}
+			sc.pos += end + 1
+		}
+		p = append(p, segment{name: name}, segment{index: position - 1, isIndex: true})
+	}
+	if len(p) == 0 {
+		return nil, sc.error("expected element name")
+	}
+	return append(p, segment{name: xmlText}), nil
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, body string) interface{} {
+	var data interface{}
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal("Invalid body:", err)
+	}
+	return data
+}
+
+func TestExprEvalPositive(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Body    string
+		Expr    string
+		Country string
+	}{
+		{Body: `{"a":"Belarus"}`, Expr: `$.a`, Country: "Belarus"},
+		{Body: `{"a":{"b":"Belarus"}}`, Expr: `$.a.b`, Country: "Belarus"},
+		{Body: `{"a b":{"c":"Belarus"}}`, Expr: `$['a b'].c`, Country: "Belarus"},
+		{Body: `{"a":[{"b":"Russia"},{"b":"Belarus"}]}`, Expr: `$.a[1].b`, Country: "Belarus"},
+		{Body: `{"a":[{"b":"Russia"},{"b":"Belarus"}]}`, Expr: `$.a[-1].b`, Country: "Belarus"},
+		{Body: `[["BY"]]`, Expr: `$[0][0]`, Country: "BY"},
+		{Body: `{"b":"Belarus"}`, Expr: `$.a || $.b`, Country: "Belarus"},
+		{Body: `{"a":"","b":"Belarus"}`, Expr: `$.a || $.b`, Country: "Belarus"},
+		{Body: `{"a":1,"b":"Belarus"}`, Expr: `$.a || $.b`, Country: "Belarus"},
+		{Body: `{"a":"Belarus"}`, Expr: `$.a | upper`, Country: "BELARUS"},
+		{Body: `{"a":" BY "}`, Expr: `$.a|trim|lower`, Country: "by"},
+		{Body: `{"b":"by"}`, Expr: `$.a | lower || $.b | upper`, Country: "BY"},
+	}
+	for _, testCase := range cases {
+		expr, err := CompileExpr(testCase.Expr)
+		if err != nil {
+			t.Fatalf("Expr `%v`: compile err: %v", testCase.Expr, err)
+		}
+		if country, err := expr.Eval(decode(t, testCase.Body)); err != nil || country != testCase.Country {
+			t.Fatalf("Expr `%v`: expected `%v`, but country : `%v` err : %v", testCase.Expr, testCase.Country, country, err)
+		}
+	}
+}
+
+func TestExprEvalNegative(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Body string
+		Expr string
+	}{
+		{Body: `{"a":"Belarus"}`, Expr: `$.i`},
+		{Body: `{"a":1}`, Expr: `$.a`},
+		{Body: `{"a":""}`, Expr: `$.a`},
+		{Body: `{"a":["Belarus"]}`, Expr: `$.a[1]`},
+		{Body: `{"a":["Belarus"]}`, Expr: `$.a[-2]`},
+		{Body: `{"a":"Belarus"}`, Expr: `$.a[0]`},
+		{Body: `{"a":"Belarus"}`, Expr: `$.a.b`},
+		{Body: `{"a":{"b":1}}`, Expr: `$.a.b || $.c`},
+	}
+	for _, testCase := range cases {
+		expr, err := CompileExpr(testCase.Expr)
+		if err != nil {
+			t.Fatalf("Expr `%v`: compile err: %v", testCase.Expr, err)
+		}
+		if country, err := expr.Eval(decode(t, testCase.Body)); err == nil {
+			t.Fatalf("Expr `%v`: no error, country `%v`", testCase.Expr, country)
+		}
+	}
+}
+
+func TestCompileNegative(t *testing.T) {
+	t.Parallel()
+
+	for _, src := range []string{``, `a.b`, `$.`, `$.a |`, `$.a | title`, `$.a ||`, `$[x]`, `$[0`, `$['a]`, `$.a $.b`} {
+		if _, err := CompileExpr(src); err == nil {
+			t.Fatalf("Expr `%v`: no compile error", src)
+		}
+	}
+	for _, src := range []string{`$.a`, `$.a = 'fail'`, `$.a == fail`, `$.a == {}`, `$.a != [1]`, `a == 1`} {
+		if _, err := CompileCond(src); err == nil {
+			t.Fatalf("Cond `%v`: no compile error", src)
+		}
+	}
+}
+
+func TestCondMatch(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Body  string
+		Cond  string
+		Match bool
+	}{
+		{Body: `{"status":"fail"}`, Cond: `$.status == 'fail'`, Match: true},
+		{Body: `{"status":"fail"}`, Cond: `$.status == "fail"`, Match: true},
+		{Body: `{"status":"success"}`, Cond: `$.status == 'fail'`, Match: false},
+		{Body: `{"status":"success"}`, Cond: `$.status != 'success'`, Match: false},
+		{Body: `{}`, Cond: `$.status != 'success'`, Match: true},
+		{Body: `{}`, Cond: `$.status == 'fail'`, Match: false},
+		{Body: `{"error":true}`, Cond: `$.error == true`, Match: true},
+		{Body: `{"code":404}`, Cond: `$.code == 404`, Match: true},
+		{Body: `{"data":null}`, Cond: `$.data == null`, Match: true},
+		{Body: `{"data":{"a":1}}`, Cond: `$.data == null`, Match: false},
+		{Body: `{"data":[{"ok":false}]}`, Cond: `$.data[0].ok==false`, Match: true},
+	}
+	for _, testCase := range cases {
+		cond, err := CompileCond(testCase.Cond)
+		if err != nil {
+			t.Fatalf("Cond `%v`: compile err: %v", testCase.Cond, err)
+		}
+		if match := cond.Match(decode(t, testCase.Body)); match != testCase.Match {
+			t.Fatalf("Cond `%v`: body %v: expected %v, but %v", testCase.Cond, testCase.Body, testCase.Match, match)
+		}
+	}
+}
+
+func TestProviderExtract(t *testing.T) {
+	t.Parallel()
+
+	provider := &Provider{
+		Extract: `$.country | upper || $.countryCode`,
+		FailIf:  []string{`$.status == 'fail'`},
+	}
+	if err := provider.Compile(); err != nil {
+		t.Fatal("Compile err:", err)
+	}
+
+	if country, err := provider.ParseBody(strings.NewReader(`{"status":"success","country":"Belarus"}`)); err != nil || country != "BELARUS" {
+		t.Fatalf("Invalid country or err: expected `BELARUS`, but country : `%s` err : %v", country, err)
+	}
+	if country, err := provider.ParseBody(strings.NewReader(`{"status":"fail","country":"Belarus"}`)); err == nil {
+		t.Fatalf("No error for failed answer, country `%v`", country)
+	}
+
+	if err := (&Provider{Extract: `$.a || b`}).Compile(); err == nil {
+		t.Fatal("No compile error of invalid expression")
+	}
+	if err := (&Provider{FailIf: []string{`$.a`}}).Compile(); err == nil {
+		t.Fatal("No compile error of invalid condition")
+	}
+}
@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// formats of provider answers
+const (
+	FormatJSON  = "json"  // default
+	FormatXML   = "xml"   // elements are addressed by XPath-like expression, e.g. `/geoPlugin/countryName`
+	FormatText  = "text"  // first line is split by delimiter into array of fields
+	FormatRegex = "regex" // array of submatches of regular expression
+)
+
+// xmlText - key of text of element in decoded XML
+const xmlText = "#text"
+
+// maxRegexBody - only this prefix of body is matched by regular expression
+const maxRegexBody = 1 << 20
+
+// decodeJSON returns decoded JSON value
+func decodeJSON(r io.Reader) (interface{}, error) {
+	var data interface{}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, errors.New("Parse Body: json err: " + err.Error())
+	}
+	return data, nil
+}
+
+// decodeXML returns tree of elements: element is object with attributes (`@name`),
+// text (`#text`) and arrays of child elements by name, document is object with root element
+func decodeXML(r io.Reader) (interface{}, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+
+	doc := map[string]interface{}{}
+	stack := []map[string]interface{}{doc}
+	var text []string // texts of open elements
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("Parse Body: xml err: " + err.Error())
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			elem := make(map[string]interface{}, len(token.Attr)+1)
+			for _, attr := range token.Attr {
+				elem["@"+attr.Name.Local] = attr.Value
+			}
+			parent := stack[len(stack)-1]
+			children, _ := parent[token.Name.Local].([]interface{})
+			parent[token.Name.Local] = append(children, elem)
+			stack = append(stack, elem)
+			text = append(text, "")
+		case xml.EndElement:
+			if len(stack) == 1 {
+				return nil, errors.New("Parse Body: xml err: unexpected end element")
+			}
+			stack[len(stack)-1][xmlText] = strings.TrimSpace(text[len(text)-1])
+			stack, text = stack[:len(stack)-1], text[:len(text)-1]
+		case xml.CharData:
+			if len(text) > 0 {
+				text[len(text)-1] += string(token)
+			}
+		}
+	}
+	if len(doc) == 0 {
+		return nil, errors.New("Parse Body: xml err: no root element")
+	}
+	return doc, nil
+}
+
+// decodeText returns fields of first line of body split by delimiter
+func decodeText(r io.Reader, delimiter string) (interface{}, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, errors.New("Parse Body: text err: " + err.Error())
+	}
+
+	parts := strings.Split(strings.TrimRight(line, "\r\n"), delimiter)
+	fields := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		fields = append(fields, strings.TrimSpace(part))
+	}
+	return fields, nil
+}
+
+// decodeRegex returns submatches of first match of re in body (whole match is the first one),
+// body is read up to maxRegexBody bytes
+func decodeRegex(r io.Reader, re *regexp.Regexp) (interface{}, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxRegexBody))
+	if err != nil {
+		return nil, errors.New("Parse Body: regex err: " + err.Error())
+	}
+
+	submatches := re.FindSubmatch(body)
+	if submatches == nil {
+		return nil, errors.New("Parse Body: regex err: no match of `" + re.String() + "`")
+	}
+	fields := make([]interface{}, 0, len(submatches))
+	for _, submatch := range submatches {
+		fields = append(fields, string(submatch))
+	}
+	return fields, nil
+}
+
+// parser - compiled settings of answer parsing of provider
+type parser struct {
+	decode  func(r io.Reader) (interface{}, error)
+	extract *Expr
+	failIf  []*Cond
+}
+
+// newParser returns parser of answers of provider p
+func newParser(p *Provider) (*parser, error) {
+	var (
+		ps  = &parser{}
+		src string // default extraction expression
+	)
+	switch p.Format {
+	case "", FormatJSON:
+		ps.decode = decodeJSON
+	case FormatXML:
+		ps.decode = decodeXML
+		if len(p.Scheme) > 0 {
+			src = "/" + strings.Join(p.Scheme, "/")
+		}
+	case FormatText:
+		if p.Delimiter == "" {
+			return nil, errors.New("delimiter of text format is empty")
+		}
+		delimiter := p.Delimiter
+		ps.decode = func(r io.Reader) (interface{}, error) { return decodeText(r, delimiter) }
+		src = "$[" + strconv.Itoa(p.Field) + "]"
+	case FormatRegex:
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, errors.New("regex err : " + err.Error())
+		}
+		if re.NumSubexp() < 1 {
+			return nil, errors.New("regex `" + p.Regex + "` has no capturing group")
+		}
+		ps.decode = func(r io.Reader) (interface{}, error) { return decodeRegex(r, re) }
+		src = "$[1]"
+	default:
+		return nil, errors.New("unknown format `" + p.Format + "`")
+	}
+
+	var err error
+	switch {
+	case p.Extract != "":
+		ps.extract, err = CompileExpr(p.Extract)
+	case src != "":
+		ps.extract, err = CompileExpr(src)
+	default:
+		ps.extract = pathExpr(p.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, src := range p.FailIf {
+		cond, err := CompileCond(src)
+		if err != nil {
+			return nil, err
+		}
+		ps.failIf = append(ps.failIf, cond)
+	}
+	return ps, nil
+}
+
+// parse returns country or error if body has invalid format or it's error answer
+func (ps *parser) parse(r io.Reader) (string, error) {
+	data, err := ps.decode(r)
+	if err != nil {
+		return "", err
+	}
+	return ps.eval(data)
+}
+
+// eval returns country or error if it's error answer
+func (ps *parser) eval(data interface{}) (string, error) {
+	for _, cond := range ps.failIf {
+		if cond.Match(data) {
+			return "", errors.New("Error answer: `" + cond.String() + "`")
+		}
+	}
+	return ps.extract.Eval(data)
+}
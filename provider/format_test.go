@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatParsePositive(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Provider Provider
+		Body     string
+		Country  string
+	}{
+		{
+			Provider: Provider{Format: FormatJSON, Scheme: []string{"a"}},
+			Body:     `{"a":"Belarus"}`,
+			Country:  "Belarus",
+		},
+		{
+			Provider: Provider{Format: FormatXML, Scheme: []string{"geoPlugin", "geoplugin_countryName"}},
+			Body: `<?xml version="1.0" encoding="UTF-8"?>
+<geoPlugin>
+	<geoplugin_request>1.2.3.4</geoplugin_request>
+	<geoplugin_countryName>Belarus</geoplugin_countryName>
+</geoPlugin>`,
+			Country: "Belarus",
+		},
+		{
+			Provider: Provider{Format: FormatXML, Extract: `/r/country[2]`},
+			Body:     `<r><country>Russia</country><country> Belarus </country></r>`,
+			Country:  "Belarus",
+		},
+		{
+			Provider: Provider{Format: FormatXML, Extract: `/r/country/@code | lower`},
+			Body:     `<r><country code="BY">Belarus</country></r>`,
+			Country:  "by",
+		},
+		{
+			Provider: Provider{Format: FormatXML, Extract: `/r/name || /r/country`},
+			Body:     `<r><name></name><country>Belarus</country></r>`,
+			Country:  "Belarus",
+		},
+		{
+			Provider: Provider{Format: FormatText, Delimiter: ";", Field: 3},
+			Body:     "1;BY;BLR;Belarus\r\n",
+			Country:  "Belarus",
+		},
+		{
+			Provider: Provider{Format: FormatText, Delimiter: ",", Extract: `$[1] | upper`},
+			Body:     "1.2.3.4, by\nsecond line",
+			Country:  "BY",
+		},
+		{
+			Provider: Provider{Format: FormatRegex, Regex: `s:12:"countryName";s:\d+:"([^"]*)"`},
+			Body:     `a:2:{s:9:"ipAddress";s:7:"1.2.3.4";s:12:"countryName";s:7:"Belarus";}`,
+			Country:  "Belarus",
+		},
+		{
+			Provider: Provider{Format: FormatRegex, Regex: `(\w+)-(\w+)`, Extract: `$[2]`},
+			Body:     `country: BY-Belarus`,
+			Country:  "Belarus",
+		},
+	}
+	for i, testCase := range cases {
+		provider := testCase.Provider
+		if err := provider.Compile(); err != nil {
+			t.Fatalf("Case [%v]: compile err: %v", i, err)
+		}
+		if country, err := provider.ParseBody(strings.NewReader(testCase.Body)); err != nil || country != testCase.Country {
+			t.Fatalf("Case [%v]: expected `%s`, but country : `%s` err : %v", i, testCase.Country, country, err)
+		}
+	}
+}
+
+func TestFormatParseNegative(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Provider Provider
+		Body     string
+	}{
+		{Provider: Provider{Format: FormatJSON, Scheme: []string{"a"}}, Body: `<a>Belarus</a>`},
+		{Provider: Provider{Format: FormatXML, Extract: `/a`}, Body: `{"a":"Belarus"}`},
+		{Provider: Provider{Format: FormatXML, Extract: `/a/b`}, Body: `<a>Belarus</a>`},
+		{Provider: Provider{Format: FormatXML, Extract: `/a/b[2]`}, Body: `<a><b>Belarus</b></a>`},
+		{Provider: Provider{Format: FormatXML, Extract: `/a/@code`}, Body: `<a>Belarus</a>`},
+		{Provider: Provider{Format: FormatText, Delimiter: ";", Field: 3}, Body: "1;BY;BLR"},
+		{
+			Provider: Provider{Format: FormatText, Delimiter: ";", Field: 3, FailIf: []string{`$[0] != '1'`}},
+			Body:     "2;;;UNKNOWN",
+		},
+		{Provider: Provider{Format: FormatRegex, Regex: `country: (\w+)`}, Body: `city: Minsk`},
+		// match is beyond limit of body
+		{Provider: Provider{Format: FormatRegex, Regex: `country: (\w+)`}, Body: strings.Repeat(" ", maxRegexBody) + `country: Belarus`},
+	}
+	for i, testCase := range cases {
+		provider := testCase.Provider
+		if err := provider.Compile(); err != nil {
+			t.Fatalf("Case [%v]: compile err: %v", i, err)
+		}
+		if country, err := provider.ParseBody(strings.NewReader(testCase.Body)); err == nil {
+			t.Fatalf("Case [%v]: no error, country `%v`", i, country)
+		}
+	}
+}
+
+func TestFormatCompileNegative(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{Format: "yaml"},
+		{Format: FormatText},
+		{Format: FormatRegex, Regex: `(`},
+		{Format: FormatRegex, Regex: `country: \w+`},
+		{Format: FormatRegex, Regex: `country: (?:\w+)`},
+		{Format: FormatXML, Extract: `/a/@b/c`},
+		{Format: FormatXML, Extract: `/a[0]`},
+		{Format: FormatXML, Extract: `/`},
+	}
+	for i := range providers {
+		if err := providers[i].Compile(); err == nil {
+			t.Fatalf("Case [%v]: no compile error", i)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// History - per-second request counts of providers,
+// i-th count of provider is number of requests in (Since+i)-th second (in Unix seconds)
+type History struct {
+	Since  int64              `json:"since"`
+	Counts map[string][]int64 `json:"counts"`
+}
+
+func (h *History) add(name string, counts []int64) {
+	sum := h.Counts[name]
+	if sum == nil {
+		sum = make([]int64, len(counts))
+		h.Counts[name] = sum
+	}
+	for i := range counts {
+		if i < len(sum) {
+			sum[i] += counts[i]
+		}
+	}
+}
+
+// Rate returns number of requests to provider for the last minute
+func (h *History) Rate(name string, now int64) (sum int64) {
+	since := now - nquants
+	for i, count := range h.Counts[name] {
+		if second := h.Since + int64(i); since <= second && second <= now {
+			sum += count
+		}
+	}
+	return
+}
+
+// restore adds request counts of the last minute from history
+func (iter *Iterator) restore(history *History, now int64) {
+	since := now - nquants
+	restored := make(map[string]bool, len(iter.blocks))
+	for i := range iter.blocks {
+		block := &iter.blocks[i]
+		name := block.provider.ID()
+		if restored[name] {
+			continue
+		}
+		restored[name] = true
+
+		for i, count := range history.Counts[name] {
+			if second := history.Since + int64(i); count > 0 && since <= second && second <= now {
+				block.rate.add(second, count)
+			}
+		}
+	}
+}
+
+// Checkpoint saves request counts of the last minute to file
+func (iter *Iterator) Checkpoint(path string) error {
+	data, err := json.Marshal(iter.History(time.Now().Unix()))
+	if err != nil {
+		return err
+	}
+
+	// write to temporary file & rename, so file is never half-written
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Restore loads request counts of the last minute from file (missing file isn't error)
+func (iter *Iterator) Restore(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var history History
+	if err := json.Unmarshal(data, &history); err != nil {
+		return err
+	}
+	iter.restore(&history, time.Now().Unix())
+	return nil
+}
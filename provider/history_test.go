@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryRate(t *testing.T) {
+	t.Parallel()
+
+	history := &History{
+		Since: 100,
+		Counts: map[string][]int64{
+			"a": {1, 2, 3},
+			"b": {4},
+		},
+	}
+	cases := []struct {
+		Name string
+		Now  int64
+		Rate int64
+	}{
+		{Name: "a", Now: 102, Rate: 6},
+		{Name: "a", Now: 101, Rate: 3},
+		{Name: "a", Now: 100 + nquants + 1, Rate: 5},
+		{Name: "a", Now: 102 + nquants + 1, Rate: 0},
+		{Name: "b", Now: 102, Rate: 4},
+		{Name: "c", Now: 102, Rate: 0},
+	}
+	for i, testCase := range cases {
+		if rate := history.Rate(testCase.Name, testCase.Now); rate != testCase.Rate {
+			t.Fatalf("Case [%v]: invalid rate: expected: %v, but %v", i, testCase.Rate, rate)
+		}
+	}
+}
+
+func TestIterHistory(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{Name: "a", MaxRate: 8},
+		{Name: "b", MaxRate: 8},
+	})
+	iter.next(100)
+	iter.next(100)
+	iter.next(130)
+
+	history := iter.History(130)
+	if history.Since != 130-nquants || len(history.Counts["a"]) != nquants+1 {
+		t.Fatalf("Invalid history: %v", history)
+	}
+	if rate := history.Rate("a", 130); rate != 3 {
+		t.Fatalf("Invalid rate: expected: 3, but %v", rate)
+	}
+	if rate := history.Rate("b", 130); rate != 0 {
+		t.Fatalf("Invalid rate: expected: 0, but %v", rate)
+	}
+}
+
+func TestIterRestore(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{Name: "a", URLPattern: "host0", MaxRate: 3},
+		{Name: "b", URLPattern: "host1", MaxRate: 3},
+	}
+	const now = 1000
+
+	history := &History{
+		Since: now - 2*nquants,
+		Counts: map[string][]int64{
+			"a": make([]int64, 2*nquants+1),
+			"c": {8},
+		},
+	}
+	history.Counts["a"][0] = 8           // too old
+	history.Counts["a"][2*nquants-1] = 2 // one second ago
+	history.Counts["a"][2*nquants] = 1   // now
+
+	iter := NewIterator(providers)
+	iter.restore(history, now)
+
+	if provider, err := iter.next(now); err != nil || provider.Name != "b" {
+		t.Fatalf("Provider `a` has restored rate 3, so next must be `b`, but %v err: %v", provider, err)
+	}
+	if rate := iter.History(now).Rate("a", now); rate != 3 {
+		t.Fatalf("Invalid restored rate: expected: 3, but %v", rate)
+	}
+}
+
+func TestIterCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	providers := []Provider{{Name: "a", MaxRate: 2}}
+
+	if err := NewIterator(providers).Restore(path); err != nil {
+		t.Fatal("Restore of missing file must be ok, but err:", err)
+	}
+
+	iter := NewIterator(providers)
+	iter.Next()
+	iter.Next()
+	if err := iter.Checkpoint(path); err != nil {
+		t.Fatal("Checkpoint err:", err)
+	}
+
+	restarted := NewIterator(providers)
+	if err := restarted.Restore(path); err != nil {
+		t.Fatal("Restore err:", err)
+	}
+	if provider, err := restarted.Next(); err != ErrNotFound {
+		t.Fatalf("Restored provider must be busy, but %v err: %v", provider, err)
+	}
+}
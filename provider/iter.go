@@ -1,9 +1,10 @@
 package provider
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"io"
+	"net/http"
 	"sync/atomic"
 	"time"
 )
@@ -21,77 +22,269 @@ type Provider struct {
 	URLPattern string            `json:"pattern"`
 	Scheme     []string          `json:"scheme"`
 	Headers    map[string]string `json:"headers"`
+	Weight     int               `json:"weight"` // weight for weighted round-robin (1 if zero)
+
+	Format    string `json:"format"`    // format of answer: json (default), xml, text or regex
+	Delimiter string `json:"delimiter"` // delimiter of fields of text format
+	Field     int    `json:"field"`     // index of field with country of text format
+	Regex     string `json:"regex"`     // regular expression with country in the first group of regex format
+
+	Extract string   `json:"extract"` // extraction expression of country (Scheme is used if empty)
+	FailIf  []string `json:"fail_if"` // conditions of error answers, e.g. `$.status == 'fail'`
+
+	// pattern, headers & body are text/templates with Vars if they contain `{{`
+	Body        string `json:"body"`
+	ContentType string `json:"content_type"`
+	Lang        string `json:"lang"`    // {{.Lang}}
+	APIKey      string `json:"api_key"` // {{.APIKey}}
+
+	Batch *Batch `json:"batch"` // batch calls are disabled if nil
+
+	Keys []Key  `json:"keys"` // pool of credentials, every key has own quota
+	Key  string `json:"-"`    // name of key of provider in iterator
+
+	parser  *parser // compiled by Compile
+	request *request
 }
 
-// ParseBody returns country or error if body has invalid format
-func (p *Provider) ParseBody(r io.Reader) (string, error) {
-	var data map[string]interface{}
-	if err := json.NewDecoder(r).Decode(&data); err != nil {
-		return "", errors.New("Parse Body: json err: " + err.Error())
+// Compile checks and compiles request templates, answer format, extraction expression
+// & conditions of provider
+func (p *Provider) Compile() (err error) {
+	if p.request, err = newRequest(p); err != nil {
+		return err
 	}
-
-	var value interface{} = data
-	for _, field := range p.Scheme {
-		m, ok := value.(map[string]interface{})
-		if !ok {
-			return "", errors.New("Invalid body format (field " + field + " type)")
+	if err = p.checkKeys(); err != nil {
+		return err
+	}
+	if p.Batch != nil {
+		if p.Format != "" && p.Format != FormatJSON {
+			return errors.New("batch calls support only json format, but format is `" + p.Format + "`")
 		}
-		value, ok = m[field]
-		if !ok {
-			return "", errors.New("Invalid body: field `" + field + "` not found")
+		if err = p.Batch.compile(); err != nil {
+			return err
 		}
 	}
+	p.parser, err = newParser(p)
+	return err
+}
 
-	country, ok := value.(string)
-	if !ok {
-		return "", errors.New("Invalid body format (last field type)")
+// NewRequest returns request to provider about addr
+func (p *Provider) NewRequest(ctx context.Context, addr string) (*http.Request, error) {
+	req := p.request
+	if req == nil { // Compile wasn't called
+		var err error
+		if req, err = newRequest(p); err != nil {
+			return nil, err
+		}
 	}
-	return country, nil
+	return req.build(ctx, &Vars{IP: addr, Lang: p.Lang, APIKey: p.APIKey})
+}
+
+// ParseBody returns country or error if body has invalid format
+func (p *Provider) ParseBody(r io.Reader) (string, error) {
+	ps := p.parser
+	if ps == nil { // Compile wasn't called
+		var err error
+		if ps, err = newParser(p); err != nil {
+			return "", err
+		}
+	}
+	return ps.parse(r)
 }
 
 // ProvBlock - provider block for iterator
 type ProvBlock struct {
 	provider Provider
 	rate     ReqRate
+	health   health
+	disabled int32 // key of provider is rejected
+}
+
+func (b *ProvBlock) isDisabled() bool {
+	return atomic.LoadInt32(&b.disabled) != 0
+}
+
+// Shared - cluster-wide request accounting
+type Shared interface {
+	// Rate returns number of requests of other replicas to provider for the last minute
+	Rate(name string, now int64) int64
 }
 
 // Iterator - main struct
 type Iterator struct {
-	index  int32
-	blocks []ProvBlock
+	index    int32
+	blocks   []ProvBlock
+	shared   Shared // nil if requests are counted only in-process
+	strategy Strategy
 }
 
-// NewIterator - constructor for Iterator struct
+// NewIterator - constructor for Iterator struct (provider with key pool is a provider per key)
 func NewIterator(providers []Provider) *Iterator {
 	blocks := make([]ProvBlock, 0, len(providers))
 	for i := range providers {
-		blocks = append(blocks, ProvBlock{provider: providers[i]})
+		// every key of pool is provider with own quota
+		for _, provider := range providers[i].expand() {
+			blocks = append(blocks, ProvBlock{provider: provider})
+		}
 	}
 	return &Iterator{
-		blocks: blocks,
+		blocks:   blocks,
+		strategy: sticky{},
+	}
+}
+
+// SetStrategy sets selection strategy by name (must be called before usage of iterator)
+func (iter *Iterator) SetStrategy(name string) error {
+	providers := make([]Provider, 0, len(iter.blocks))
+	for i := range iter.blocks {
+		providers = append(providers, iter.blocks[i].provider)
+	}
+
+	strategy, err := NewStrategy(name, providers)
+	if err != nil {
+		return err
+	}
+	iter.strategy = strategy
+	return nil
+}
+
+// block returns block of provider returned by iterator
+func (iter *Iterator) block(provider *Provider) *ProvBlock {
+	for i := range iter.blocks {
+		if block := &iter.blocks[i]; &block.provider == provider {
+			return block
+		}
+	}
+	return nil
+}
+
+// Share sets cluster-wide request accounting (must be called before usage of iterator)
+func (iter *Iterator) Share(shared Shared) {
+	iter.shared = shared
+}
+
+// rate returns number of requests to provider of block for the last minute
+func (iter *Iterator) rate(block *ProvBlock, now int64) int64 {
+	rate := block.rate.rate(now)
+	if iter.shared != nil {
+		rate += iter.shared.Rate(block.provider.ID(), now)
 	}
+	return rate
+}
+
+// History returns local request counts of all providers for the last minute
+func (iter *Iterator) History(now int64) *History {
+	history := &History{Since: now - nquants, Counts: make(map[string][]int64, len(iter.blocks))}
+	for i := range iter.blocks {
+		block := &iter.blocks[i]
+		history.add(block.provider.ID(), block.rate.history(now))
+	}
+	return history
 }
 
 func (iter *Iterator) next(now int64) (provider *Provider, err error) {
-	first, len := atomic.LoadInt32(&iter.index), int32(len(iter.blocks))
+	return iter.nextExcept(now)
+}
 
-	index := first
-	for {
+func (iter *Iterator) nextExcept(now int64, except ...*Provider) (provider *Provider, err error) {
+loop:
+	for _, index := range iter.strategy.order(iter, now) {
 		block := &iter.blocks[index]
-		if rate := block.rate.rate(now); rate < block.provider.MaxRate {
+		for _, p := range except { // other keys of pool are the same upstream
+			if block.provider.Name == p.Name {
+				continue loop
+			}
+		}
+		if block.isDisabled() {
+			continue
+		}
+		if rate := iter.rate(block, now); rate < block.provider.MaxRate {
+			if !iter.reserve(block, now) {
+				continue
+			}
 			block.rate.observe(now)
-			atomic.StoreInt32(&iter.index, index)
+			if len(except) == 0 { // extra requests don't change current provider
+				atomic.StoreInt32(&iter.index, int32(index))
+			}
 			return &block.provider, nil
 		}
-
-		if index = (index + 1) % len; index == first {
-			break
-		}
 	}
 	return nil, ErrNotFound
 }
 
+// reserve reserves trial request of unhealthy provider ordered first by fastest strategy,
+// it fails if concurrent request has reserved the trial
+func (iter *Iterator) reserve(block *ProvBlock, now int64) bool {
+	if _, ok := iter.strategy.(fastest); !ok || block.health.healthy() || !block.health.due(now) {
+		return true
+	}
+	return block.health.trial(now)
+}
+
 // Next - check request rate and returns next provider
 func (iter *Iterator) Next() (provider *Provider, err error) {
 	return iter.next(time.Now().Unix())
 }
+
+// NextAt - Next, which counts request in this second (unix time), it's used by Release
+func (iter *Iterator) NextAt(now int64) (provider *Provider, err error) {
+	return iter.next(now)
+}
+
+// Release returns request taken by NextAt (NextExceptAt) in this second back to provider
+// (e.g. if it's joined to batch call), so count of other second doesn't go negative
+func (iter *Iterator) Release(provider *Provider, counted int64) {
+	if block := iter.block(provider); block != nil {
+		block.rate.add(counted, -1)
+	}
+}
+
+// Providers returns providers of iterator in config order
+func (iter *Iterator) Providers() []*Provider {
+	providers := make([]*Provider, 0, len(iter.blocks))
+	for i := range iter.blocks {
+		providers = append(providers, &iter.blocks[i].provider)
+	}
+	return providers
+}
+
+// Len returns number of distinct providers of iterator (keys of pool are one provider)
+func (iter *Iterator) Len() int {
+	names := make(map[string]bool, len(iter.blocks))
+	for i := range iter.blocks {
+		names[iter.blocks[i].provider.Name] = true
+	}
+	return len(names)
+}
+
+// NextExcept - check request rate and returns next provider other than except ones
+// and other keys of their pools (e.g. for hedged requests)
+func (iter *Iterator) NextExcept(except ...*Provider) (provider *Provider, err error) {
+	return iter.nextExcept(time.Now().Unix(), except...)
+}
+
+// NextExceptAt - NextExcept, which counts request in this second (unix time), it's used by Release
+func (iter *Iterator) NextExceptAt(now int64, except ...*Provider) (provider *Provider, err error) {
+	return iter.nextExcept(now, except...)
+}
+
+func (iter *Iterator) spare(now int64, fraction float64) (provider *Provider, err error) {
+	for i := range iter.blocks {
+		block := &iter.blocks[i]
+		if block.isDisabled() {
+			continue
+		}
+		limit := int64(fraction * float64(block.provider.MaxRate))
+		if rate := iter.rate(block, now); rate < limit {
+			block.rate.observe(now)
+			return &block.provider, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Spare returns provider, which request rate is below fraction of its MaxRate
+// (background jobs use it, so they don't take away capacity from clients)
+func (iter *Iterator) Spare(fraction float64) (provider *Provider, err error) {
+	return iter.spare(time.Now().Unix(), fraction)
+}
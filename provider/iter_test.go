@@ -105,3 +105,100 @@ func TestIterNegative(t *testing.T) {
 		}
 	}
 }
+
+func TestIterSpare(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{URLPattern: "host0", MaxRate: 4},
+		{URLPattern: "host1", MaxRate: 2},
+	}
+	iter := NewIterator(providers)
+	cases := []struct {
+		Now        int64
+		URLPattern string
+	}{
+		{Now: 0, URLPattern: "host0"},
+		{Now: 1, URLPattern: "host0"},
+		{Now: 2, URLPattern: "host1"},
+		{Now: 3, URLPattern: ""},
+		{Now: 61, URLPattern: "host0"},
+	}
+	for i, testCase := range cases {
+		provider, err := iter.spare(testCase.Now, 0.5)
+		if testCase.URLPattern == "" {
+			if err != ErrNotFound {
+				t.Fatalf("Iteration [%v]: must be err: %v, but actual: %v err: %v", i, ErrNotFound, provider, err)
+			}
+			continue
+		}
+		if err != nil || provider.URLPattern != testCase.URLPattern {
+			t.Fatalf("Iteration [%v]: must be host: `%v`, but actual: %v err: %v", i, testCase.URLPattern, provider, err)
+		}
+	}
+}
+
+// shared - stub of cluster-wide request accounting
+type shared map[string]int64
+
+func (s shared) Rate(name string, now int64) int64 {
+	return s[name]
+}
+
+func TestIterNextExcept(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{Name: "host0", URLPattern: "host0", MaxRate: 4},
+		{Name: "host1", URLPattern: "host1", MaxRate: 1},
+		{Name: "host2", URLPattern: "host2", MaxRate: 4},
+	}
+	iter := NewIterator(providers)
+	primary, err := iter.next(0)
+	if err != nil || primary.URLPattern != "host0" {
+		t.Fatalf("Must be host: `host0`, but actual: %v err: %v", primary, err)
+	}
+	if second, err := iter.nextExcept(0, primary); err != nil || second.URLPattern != "host1" {
+		t.Fatalf("Must be host: `host1`, but actual: %v err: %v", second, err)
+	}
+	if third, err := iter.nextExcept(0, primary); err != nil || third.URLPattern != "host2" {
+		t.Fatalf("Must be host: `host2`, but actual: %v err: %v", third, err)
+	}
+	if p, err := iter.nextExcept(0, primary, &iter.blocks[2].provider); err != ErrNotFound {
+		t.Fatalf("Must be err: %v, but actual: %v err: %v", ErrNotFound, p, err)
+	}
+	if rate := iter.blocks[0].rate.rate(0); rate != 1 {
+		t.Fatalf("Excepted provider is counted: rate %v", rate)
+	}
+}
+
+func TestIterShared(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{Name: "host0", URLPattern: "host0", MaxRate: 2},
+		{Name: "host1", URLPattern: "host1", MaxRate: 2},
+	}
+	iter := NewIterator(providers)
+	iter.Share(shared{"host0": 1, "host1": 2})
+
+	cases := []struct {
+		Now        int64
+		URLPattern string
+	}{
+		{Now: 0, URLPattern: "host0"},
+		{Now: 1, URLPattern: ""},
+	}
+	for i, testCase := range cases {
+		provider, err := iter.next(testCase.Now)
+		if testCase.URLPattern == "" {
+			if err != ErrNotFound {
+				t.Fatalf("Iteration [%v]: must be err: %v, but actual: %v err: %v", i, ErrNotFound, provider, err)
+			}
+			continue
+		}
+		if err != nil || provider.URLPattern != testCase.URLPattern {
+			t.Fatalf("Iteration [%v]: must be host: `%v`, but actual: %v err: %v", i, testCase.URLPattern, provider, err)
+		}
+	}
+}
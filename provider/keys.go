@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Key - credentials of provider with own quota
+type Key struct {
+	Name    string            `json:"name"`
+	APIKey  string            `json:"api_key"`  // {{.APIKey}}
+	Headers map[string]string `json:"headers"`  // override headers of provider
+	MaxRate int64             `json:"max_rate"` // max_rate of provider if zero
+}
+
+// StatusError - unexpected HTTP status of provider answer
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "Invalid status code:" + e.Status
+}
+
+// rejected returns true if err means, that credentials are rejected by provider
+func rejected(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && (status.Code == http.StatusUnauthorized || status.Code == http.StatusForbidden)
+}
+
+// checkKeys checks key pool of provider
+func (p *Provider) checkKeys() error {
+	names := make(map[string]bool, len(p.Keys))
+	for i := range p.Keys {
+		key := &p.Keys[i]
+		if key.Name == "" {
+			return errors.New("name of key " + strconv.Itoa(i) + " is empty")
+		}
+		if names[key.Name] {
+			return errors.New("duplicate key `" + key.Name + "`")
+		}
+		names[key.Name] = true
+
+		for name, value := range key.Headers {
+			if _, err := parseTemplate(name, value); err != nil {
+				return errors.New("key `" + key.Name + "`: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// expand returns provider for every key of pool (or provider itself if it has no keys)
+func (p *Provider) expand() []Provider {
+	if len(p.Keys) == 0 {
+		return []Provider{*p}
+	}
+
+	providers := make([]Provider, 0, len(p.Keys))
+	for i := range p.Keys {
+		key := &p.Keys[i]
+
+		provider := *p
+		provider.Keys = nil
+		provider.Key = key.Name
+		provider.APIKey = key.APIKey
+		if key.MaxRate > 0 {
+			provider.MaxRate = key.MaxRate
+		}
+		provider.Headers = merge(p.Headers, key.Headers)
+		if p.Batch != nil { // batch calls are made with the same key
+			batch := *p.Batch
+			batch.Headers = merge(p.Batch.Headers, key.Headers)
+			provider.Batch = &batch
+		}
+
+		if p.request != nil { // compiled provider, headers are checked by Compile
+			provider.request, _ = newRequest(&provider)
+			if provider.Batch != nil {
+				provider.Batch.request, _ = provider.Batch.newRequest()
+			}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// merge returns copy of headers with overrides
+func merge(headers, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(headers)+len(overrides))
+	for name, value := range headers {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		merged[name] = value
+	}
+	return merged
+}
+
+// ID returns name of provider with name of its key
+func (p *Provider) ID() string {
+	if p.Key == "" {
+		return p.Name
+	}
+	return p.Name + "/" + p.Key
+}
@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIterKeys(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{
+			Name:       "pool",
+			URLPattern: "http://host/{{.IP}}?key={{.APIKey}}",
+			Headers:    map[string]string{"Authorization": "Token Default", "Accept": "application/json"},
+			MaxRate:    2,
+			Keys: []Key{
+				{Name: "a", APIKey: "keyA", MaxRate: 1},
+				{Name: "b", APIKey: "keyB", Headers: map[string]string{"Authorization": "Token B"}},
+			},
+		},
+		{Name: "single", URLPattern: "host1", MaxRate: 1},
+	}
+	for i := range providers {
+		if err := providers[i].Compile(); err != nil {
+			t.Fatal("Compile err:", err)
+		}
+	}
+
+	iter := NewIterator(providers)
+	if len(iter.blocks) != 3 {
+		t.Fatalf("Invalid number of blocks: %v", len(iter.blocks))
+	}
+
+	cases := []struct {
+		Key           string
+		URL           string
+		Authorization string
+	}{
+		{Key: "a", URL: "http://host/1.2.3.4?key=keyA", Authorization: "Token Default"},
+		{Key: "b", URL: "http://host/1.2.3.4?key=keyB", Authorization: "Token B"},
+		{Key: "b", URL: "http://host/1.2.3.4?key=keyB", Authorization: "Token B"},
+	}
+	for i, testCase := range cases {
+		provider, err := iter.next(0)
+		if err != nil || provider.Key != testCase.Key {
+			t.Fatalf("Iteration [%v]: must be key `%v`, but actual: %v err: %v", i, testCase.Key, provider, err)
+		}
+		req, err := provider.NewRequest(context.Background(), "1.2.3.4")
+		if err != nil {
+			t.Fatalf("Iteration [%v]: request err: %v", i, err)
+		}
+		if req.URL.String() != testCase.URL || req.Header.Get("Authorization") != testCase.Authorization ||
+			req.Header.Get("Accept") != "application/json" {
+			t.Fatalf("Iteration [%v]: invalid request: %v %v", i, req.URL, req.Header)
+		}
+	}
+
+	history := iter.History(0)
+	if _, ok := history.Counts["pool/a"]; !ok || len(history.Counts) != 3 {
+		t.Fatalf("Invalid history names: %v", history.Counts)
+	}
+}
+
+func TestIterKeyRejected(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{Name: "pool", URLPattern: "host0", MaxRate: 4, Keys: []Key{{Name: "a"}, {Name: "b"}}},
+		{Name: "single", URLPattern: "host1", MaxRate: 4},
+	})
+	if err := iter.SetStrategy(StrategyPriority); err != nil {
+		t.Fatal("Strategy err:", err)
+	}
+
+	unauthorized := fmt.Errorf("wrapped: %w", &StatusError{Code: http.StatusUnauthorized, Status: "401 Unauthorized"})
+	if iter.Report(&iter.blocks[0].provider, time.Millisecond, errors.New("timeout")) {
+		t.Fatal("Key is disabled by other error")
+	}
+	if !iter.Report(&iter.blocks[0].provider, time.Millisecond, unauthorized) {
+		t.Fatal("Key isn't disabled")
+	}
+	if iter.Report(&iter.blocks[2].provider, time.Millisecond, &StatusError{Code: http.StatusForbidden}) {
+		t.Fatal("Provider without key pool is disabled")
+	}
+
+	if provider, err := iter.next(0); err != nil || provider.Key != "b" {
+		t.Fatalf("Must be key `b`, but actual: %v err: %v", provider, err)
+	}
+	if provider, err := iter.spare(0, 1); err != nil || provider.Key != "b" {
+		t.Fatalf("Must be key `b`, but actual: %v err: %v", provider, err)
+	}
+	if stats := iter.stats(0); !stats[0].Disabled || stats[1].Disabled || stats[0].Key != "a" {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+}
+
+func TestIterNextExceptKeys(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{Name: "pool", URLPattern: "host0", MaxRate: 4, Keys: []Key{{Name: "k1"}, {Name: "k2"}}},
+		{Name: "single", URLPattern: "host1", MaxRate: 4},
+	})
+	if n := iter.Len(); n != 2 {
+		t.Fatalf("Keys of pool are one provider, but %v providers", n)
+	}
+
+	primary, err := iter.next(0)
+	if err != nil || primary.ID() != "pool/k1" {
+		t.Fatalf("Must be provider: `pool/k1`, but actual: %v err: %v", primary, err)
+	}
+	// other key of pool is the same upstream
+	for i := 0; i < 4; i++ {
+		if second, err := iter.nextExcept(0, primary); err != nil || second.Name != "single" {
+			t.Fatalf("Iteration [%v]: must be provider: `single`, but actual: %v err: %v", i, second, err)
+		}
+	}
+	if p, err := iter.nextExcept(0, primary); err != ErrNotFound {
+		t.Fatalf("Must be err: %v, but actual: %v err: %v", ErrNotFound, p, err)
+	}
+}
+
+func TestProviderKeysNegative(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{Keys: []Key{{Name: ""}}},
+		{Keys: []Key{{Name: "a"}, {Name: "a"}}},
+		{Keys: []Key{{Name: "a", Headers: map[string]string{"X-Key": "{{.APIKey"}}}},
+	}
+	for i := range providers {
+		if err := providers[i].Compile(); err == nil {
+			t.Fatalf("Case [%v]: no compile error", i)
+		}
+	}
+}
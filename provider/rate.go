@@ -79,6 +79,11 @@ func (r *ReqRate) clean(now int64) {
 }
 
 func (r *ReqRate) observe(now int64) {
+	r.add(now, 1)
+}
+
+// add registers n requests in this second
+func (r *ReqRate) add(now, n int64) {
 	// help clean up ReqRate struct
 	r.clean(now)
 
@@ -93,7 +98,7 @@ func (r *ReqRate) observe(now int64) {
 
 			// register request in the new block
 			index := now - block.offset
-			block.counts[index] = 1
+			block.counts[index] = n
 
 			// try add new block to block list
 			if atomic.CompareAndSwapPointer(indirect, block.next, unsafe.Pointer(block)) {
@@ -107,13 +112,12 @@ func (r *ReqRate) observe(now int64) {
 
 		// this block is needed, so increment count
 		if index := now - this.offset; 0 <= index && index < blockSize {
-			atomic.AddInt64(&this.counts[index], 1)
+			atomic.AddInt64(&this.counts[index], n)
 			return
 		}
 
 		indirect = &this.next
 	}
-
 }
 
 // Observe - register request with this time
@@ -166,6 +170,29 @@ func (r *ReqRate) rate(now int64) (sum int64) {
 	return
 }
 
+// count returns number of requests in this second
+func (r *ReqRate) count(second int64) int64 {
+	for this := r.Head(); this != nil && this.offset <= second; this = this.Next() {
+		if index := second - this.offset; index < blockSize {
+			return atomic.LoadInt64(&this.counts[index])
+		}
+	}
+	return 0
+}
+
+// history returns per-second numbers of requests for the last minute,
+// i-th count is for (now-nquants+i)-th second
+func (r *ReqRate) history(now int64) []int64 {
+	// help clean up ReqRate struct
+	r.clean(now)
+
+	counts := make([]int64, nquants+1)
+	for i := range counts {
+		counts[i] = r.count(now - nquants + int64(i))
+	}
+	return counts
+}
+
 // Rate returns request number for the last minute
 func (r *ReqRate) Rate(now time.Time) int64 {
 	return r.rate(now.Unix())
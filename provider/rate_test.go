@@ -38,3 +38,34 @@ func TestReqRateClean(t *testing.T) {
 		t.Fatal("Clean doesn't delete all expired blocks")
 	}
 }
+
+func TestReqRateHistory(t *testing.T) {
+	t.Parallel()
+
+	const offset = 128
+
+	rate := &ReqRate{offset: offset}
+	rate.observe(offset + 10)
+	rate.observe(offset + 10)
+	rate.observe(offset + blockSize + 1)
+
+	now := int64(offset + blockSize + 1)
+	counts := rate.history(now)
+	if len(counts) != nquants+1 {
+		t.Fatalf("Invalid history length: expected: %v, but %v", nquants+1, len(counts))
+	}
+	if count := counts[nquants]; count != 1 {
+		t.Fatalf("Invalid count of now: expected: 1, but %v", count)
+	}
+	if index := offset + 10 - (now - nquants); counts[index] != 2 {
+		t.Fatalf("Invalid count of offset+10: expected: 2, but %v", counts[index])
+	}
+
+	var sum int64
+	for _, count := range counts {
+		sum += count
+	}
+	if nreq := rate.rate(now); sum != nreq {
+		t.Fatalf("Sum of history %v isn't equal to rate %v", sum, nreq)
+	}
+}
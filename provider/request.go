@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// Vars - variables of request templates of provider
+type Vars struct {
+	IP     string
+	IPs    []string // IPs of batch call
+	Lang   string
+	APIKey string
+}
+
+// functions of request templates in addition to standard ones (urlquery, js, html, ...)
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// request - compiled templates of requests to provider
+type request struct {
+	method      string
+	url         *template.Template // nil if legacy pattern is used
+	pattern     string             // legacy URL pattern with %s for IP (or URL without IP)
+	headers     map[string]*template.Template
+	body        *template.Template // nil if request has no body
+	contentType string
+}
+
+// isTemplate returns true if s is template (otherwise it's used as is)
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.New("template err : " + err.Error())
+	}
+	return tmpl, nil
+}
+
+// newRequest returns compiled templates of requests to provider p
+func newRequest(p *Provider) (*request, error) {
+	req := &request{
+		method:      p.Method,
+		pattern:     p.URLPattern,
+		headers:     make(map[string]*template.Template, len(p.Headers)),
+		contentType: p.ContentType,
+	}
+	if req.method == "" {
+		req.method = http.MethodGet
+	}
+
+	var err error
+	if isTemplate(p.URLPattern) {
+		if req.url, err = parseTemplate("pattern", p.URLPattern); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range p.Headers {
+		if req.headers[key], err = parseTemplate(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if p.Body != "" {
+		if req.body, err = parseTemplate("body", p.Body); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func execute(tmpl *template.Template, vars *Vars) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", errors.New("template err : " + err.Error())
+	}
+	return buf.String(), nil
+}
+
+// build returns HTTP request with executed templates
+func (req *request) build(ctx context.Context, vars *Vars) (*http.Request, error) {
+	url := req.pattern
+	switch {
+	case req.url != nil:
+		var err error
+		if url, err = execute(req.url, vars); err != nil {
+			return nil, err
+		}
+	case strings.Contains(url, "%"):
+		url = fmt.Sprintf(req.pattern, vars.IP)
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		data, err := execute(req.body, vars)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(data)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, req.method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, tmpl := range req.headers {
+		value, err := execute(tmpl, vars)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set(key, value)
+	}
+	if req.contentType != "" {
+		r.Header.Set("Content-Type", req.contentType)
+	}
+	return r, nil
+}
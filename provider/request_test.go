@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestProviderNewRequest(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Provider    Provider
+		Method      string
+		URL         string
+		Headers     map[string]string
+		Body        string
+		ContentType string
+	}{
+		{
+			Provider: Provider{Method: "GET", URLPattern: "http://host/json/%s", Headers: map[string]string{"Authorization": "Token T"}},
+			Method:   "GET",
+			URL:      "http://host/json/1.2.3.4",
+			Headers:  map[string]string{"Authorization": "Token T"},
+		},
+		{
+			Provider: Provider{URLPattern: "http://host/{{.IP}}?lang={{.Lang}}&key={{urlquery .APIKey}}", Lang: "en", APIKey: "a&b"},
+			Method:   "GET",
+			URL:      "http://host/1.2.3.4?lang=en&key=a%26b",
+		},
+		{
+			Provider: Provider{
+				Method:      "POST",
+				URLPattern:  "http://host/rpc",
+				Headers:     map[string]string{"X-Api-Key": "{{.APIKey}}"},
+				Body:        `{"jsonrpc":"2.0","method":"geo","params":{"ip":{{json .IP}},"lang":"{{.Lang}}"},"id":1}`,
+				ContentType: "application/json",
+				Lang:        "ru",
+				APIKey:      "key",
+			},
+			Method:      "POST",
+			URL:         "http://host/rpc",
+			Headers:     map[string]string{"X-Api-Key": "key"},
+			Body:        `{"jsonrpc":"2.0","method":"geo","params":{"ip":"1.2.3.4","lang":"ru"},"id":1}`,
+			ContentType: "application/json",
+		},
+	}
+	for i, testCase := range cases {
+		provider := testCase.Provider
+		if err := provider.Compile(); err != nil {
+			t.Fatalf("Case [%v]: compile err: %v", i, err)
+		}
+
+		req, err := provider.NewRequest(context.Background(), "1.2.3.4")
+		if err != nil {
+			t.Fatalf("Case [%v]: request err: %v", i, err)
+		}
+		if req.Method != testCase.Method || req.URL.String() != testCase.URL {
+			t.Fatalf("Case [%v]: invalid request: %v %v", i, req.Method, req.URL)
+		}
+		for key, value := range testCase.Headers {
+			if actual := req.Header.Get(key); actual != value {
+				t.Fatalf("Case [%v]: header %v: expected `%v`, but `%v`", i, key, value, actual)
+			}
+		}
+		if actual := req.Header.Get("Content-Type"); actual != testCase.ContentType {
+			t.Fatalf("Case [%v]: content type: expected `%v`, but `%v`", i, testCase.ContentType, actual)
+		}
+
+		var body []byte
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+		}
+		if string(body) != testCase.Body {
+			t.Fatalf("Case [%v]: body: expected `%v`, but `%v`", i, testCase.Body, string(body))
+		}
+	}
+}
+
+func TestProviderNewRequestNegative(t *testing.T) {
+	t.Parallel()
+
+	providers := []Provider{
+		{URLPattern: "http://host/{{.IP"},
+		{URLPattern: "http://host/", Headers: map[string]string{"X-Key": "{{end}}"}},
+		{URLPattern: "http://host/", Method: http.MethodPost, Body: "{{unknown .IP}}"},
+	}
+	for i := range providers {
+		if err := providers[i].Compile(); err == nil {
+			t.Fatalf("Case [%v]: no compile error", i)
+		}
+	}
+
+	provider := &Provider{URLPattern: "http://host/{{.Country}}"}
+	if err := provider.Compile(); err != nil {
+		t.Fatal("Compile err:", err)
+	}
+	if _, err := provider.NewRequest(context.Background(), "1.2.3.4"); err == nil {
+		t.Fatal("No error of unknown variable")
+	}
+}
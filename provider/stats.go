@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ewmaAlpha = 0.2 // weight of new sample
+
+	// provider is unhealthy if EWMA of its error rate is above this value
+	maxErrorRate = 0.5
+
+	windowSize = 128 // number of latest latencies for quantiles
+
+	// unhealthy provider gets trial request once per this number of seconds since its latest failure,
+	// successful trial makes it healthy again
+	probeInterval = 30
+)
+
+// ewma - lock-free exponentially weighted moving average
+type ewma struct {
+	bits    uint64 // real type is float64
+	samples int64
+}
+
+func (e *ewma) value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&e.bits))
+}
+
+func (e *ewma) observe(sample float64) {
+	// first sample is the average
+	if atomic.AddInt64(&e.samples, 1) == 1 {
+		atomic.StoreUint64(&e.bits, math.Float64bits(sample))
+		return
+	}
+
+	for {
+		old := atomic.LoadUint64(&e.bits)
+		value := math.Float64frombits(old)
+		value += ewmaAlpha * (sample - value)
+		if atomic.CompareAndSwapUint64(&e.bits, old, math.Float64bits(value)) {
+			return
+		}
+	}
+}
+
+func (e *ewma) set(value float64) {
+	atomic.StoreUint64(&e.bits, math.Float64bits(value))
+}
+
+// window - lock-free ring of latest samples
+type window struct {
+	next    uint64
+	samples [windowSize]int64
+}
+
+func (w *window) observe(sample int64) {
+	index := atomic.AddUint64(&w.next, 1) - 1
+	atomic.StoreInt64(&w.samples[index%windowSize], sample)
+}
+
+// quantile returns q-quantile of samples (false if there are no samples)
+func (w *window) quantile(q float64) (int64, bool) {
+	n := atomic.LoadUint64(&w.next)
+	if n == 0 {
+		return 0, false
+	}
+	if n > windowSize {
+		n = windowSize
+	}
+
+	samples := make([]int64, n)
+	for i := range samples {
+		samples[i] = atomic.LoadInt64(&w.samples[i])
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	// nearest-rank method
+	rank := int(math.Ceil(q * float64(n)))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(samples) {
+		rank = len(samples)
+	}
+	return samples[rank-1], true
+}
+
+// health - EWMA of latency & error rate of provider
+type health struct {
+	latency ewma  // in nanoseconds, only of successful requests
+	errors  ewma  // 1 for failed request, 0 for successful one
+	probe   int64 // unix time of latest failure or trial request
+
+	latest window // latencies of successful requests
+}
+
+func (h *health) observe(latency time.Duration, err error) {
+	if err != nil {
+		h.errors.observe(1)
+		atomic.StoreInt64(&h.probe, time.Now().Unix())
+		return
+	}
+
+	if h.errors.observe(0); !h.healthy() {
+		// successful trial, next failure makes provider unhealthy again
+		h.errors.set(maxErrorRate)
+	}
+	h.latency.observe(float64(latency))
+	h.latest.observe(int64(latency))
+}
+
+func (h *health) healthy() bool {
+	return h.errors.value() <= maxErrorRate
+}
+
+// due returns true if trial request of unhealthy provider is allowed (once per probeInterval)
+func (h *health) due(now int64) bool {
+	return now-atomic.LoadInt64(&h.probe) >= probeInterval
+}
+
+// trial reserves trial request of unhealthy provider, it's allowed once per probeInterval
+func (h *health) trial(now int64) bool {
+	last := atomic.LoadInt64(&h.probe)
+	return now-last >= probeInterval && atomic.CompareAndSwapInt64(&h.probe, last, now)
+}
+
+// estimate returns EWMA of latency, it's infinite if all requests have failed
+func (h *health) estimate() float64 {
+	if atomic.LoadInt64(&h.latency.samples) == 0 && atomic.LoadInt64(&h.errors.samples) != 0 {
+		return math.Inf(1)
+	}
+	return h.latency.value()
+}
+
+// Stats - statistics of provider
+type Stats struct {
+	Name      string
+	Key       string // name of key of pool
+	Rate      int64  // number of requests for the last minute (cluster-wide if it's shared)
+	MaxRate   int64
+	Latency   time.Duration // EWMA of latency of successful requests
+	ErrorRate float64       // EWMA of error rate
+	Samples   int64         // number of reported requests
+	Healthy   bool
+	Disabled  bool // key is rejected by provider
+}
+
+// Report registers latency & result of request to provider returned by iterator,
+// key of pool is disabled if it's rejected by provider, returns true in such case
+func (iter *Iterator) Report(provider *Provider, latency time.Duration, err error) (disabled bool) {
+	block := iter.block(provider)
+	if block == nil {
+		return false
+	}
+	block.health.observe(latency, err)
+	if provider.Key != "" && rejected(err) {
+		return atomic.CompareAndSwapInt32(&block.disabled, 0, 1)
+	}
+	return false
+}
+
+// Quantile returns q-quantile of latest latencies of successful requests to provider
+// returned by iterator (false if there are no such requests)
+func (iter *Iterator) Quantile(provider *Provider, q float64) (time.Duration, bool) {
+	if block := iter.block(provider); block != nil {
+		latency, ok := block.health.latest.quantile(q)
+		return time.Duration(latency), ok
+	}
+	return 0, false
+}
+
+func (iter *Iterator) stats(now int64) []Stats {
+	stats := make([]Stats, 0, len(iter.blocks))
+	for i := range iter.blocks {
+		block := &iter.blocks[i]
+		stats = append(stats, Stats{
+			Name:      block.provider.Name,
+			Key:       block.provider.Key,
+			Rate:      iter.rate(block, now),
+			MaxRate:   block.provider.MaxRate,
+			Latency:   time.Duration(block.health.latency.value()),
+			ErrorRate: block.health.errors.value(),
+			Samples:   atomic.LoadInt64(&block.health.errors.samples),
+			Healthy:   block.health.healthy(),
+			Disabled:  block.isDisabled(),
+		})
+	}
+	return stats
+}
+
+// Stats returns statistics of all providers
+func (iter *Iterator) Stats() []Stats {
+	return iter.stats(time.Now().Unix())
+}
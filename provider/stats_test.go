@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEWMA(t *testing.T) {
+	t.Parallel()
+
+	var e ewma
+	cases := []struct {
+		Sample float64
+		Value  float64
+	}{
+		{Sample: 10, Value: 10},
+		{Sample: 20, Value: 12},
+		{Sample: 2, Value: 10},
+	}
+	for i, testCase := range cases {
+		if e.observe(testCase.Sample); math.Abs(e.value()-testCase.Value) > 1e-9 {
+			t.Fatalf("Sample [%v]: expected: %v, but %v", i, testCase.Value, e.value())
+		}
+	}
+}
+
+func TestIterStats(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{Name: "slow", URLPattern: "host0", MaxRate: 4},
+		{Name: "failing", URLPattern: "host1", MaxRate: 4},
+		{Name: "fast", URLPattern: "host2", MaxRate: 1},
+	})
+	if err := iter.SetStrategy(StrategyFastest); err != nil {
+		t.Fatal("Strategy err:", err)
+	}
+
+	failure := errors.New("failure")
+	iter.Report(&iter.blocks[0].provider, 100*time.Millisecond, nil)
+	iter.Report(&iter.blocks[1].provider, time.Millisecond, failure)
+	iter.Report(&iter.blocks[1].provider, time.Millisecond, failure)
+	iter.Report(&iter.blocks[2].provider, 10*time.Millisecond, nil)
+
+	stats := iter.stats(0)
+	if len(stats) != 3 || stats[1].Healthy || !stats[0].Healthy || stats[1].ErrorRate != 1 || stats[1].Samples != 2 {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+	if stats[2].Latency != 10*time.Millisecond {
+		t.Fatalf("Invalid latency: expected: %v, but %v", 10*time.Millisecond, stats[2].Latency)
+	}
+
+	// fast, then slow (failing provider is faster, but unhealthy)
+	for i, name := range []string{"fast", "slow", "slow", "slow", "slow", "failing"} {
+		if provider, err := iter.next(0); err != nil || provider.Name != name {
+			t.Fatalf("Iteration [%v]: must be provider: `%v`, but actual: %v err: %v", i, name, provider, err)
+		}
+	}
+	if stats := iter.stats(0); stats[0].Rate != 4 || stats[2].Rate != 1 {
+		t.Fatalf("Invalid rates: %+v", stats)
+	}
+}
+
+func TestIterRecovery(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{Name: "slow", URLPattern: "host0", MaxRate: 100},
+		{Name: "failing", URLPattern: "host1", MaxRate: 100},
+	})
+	if err := iter.SetStrategy(StrategyFastest); err != nil {
+		t.Fatal("Strategy err:", err)
+	}
+	slow, failing := &iter.blocks[0].provider, &iter.blocks[1].provider
+
+	// latencies of failed requests aren't taken into account
+	iter.Report(slow, 100*time.Millisecond, nil)
+	iter.Report(failing, time.Millisecond, nil)
+	for i := 0; i < 4; i++ {
+		iter.Report(failing, time.Hour, errors.New("failure"))
+	}
+	if stats := iter.stats(0); stats[1].Healthy || stats[1].Latency != time.Millisecond || stats[1].Samples != 5 {
+		t.Fatalf("Invalid stats: %+v", stats[1])
+	}
+
+	// one trial request per probeInterval since the latest failure
+	probe := iter.blocks[1].health.probe
+	for i, testCase := range []struct {
+		Now  int64
+		Name string
+	}{
+		{Now: probe + 1, Name: "slow"},
+		{Now: probe + probeInterval, Name: "failing"},
+		{Now: probe + probeInterval, Name: "slow"},
+		{Now: probe + probeInterval + 1, Name: "slow"},
+		{Now: probe + 2*probeInterval, Name: "failing"},
+	} {
+		if provider, err := iter.next(testCase.Now); err != nil || provider.Name != testCase.Name {
+			t.Fatalf("Iteration [%v]: must be provider: `%v`, but actual: %v err: %v", i, testCase.Name, provider, err)
+		}
+	}
+
+	// successful trial makes provider healthy
+	iter.Report(failing, time.Millisecond, nil)
+	if stats := iter.stats(0); !stats[1].Healthy {
+		t.Fatalf("Provider must be healthy after successful trial: %+v", stats[1])
+	}
+	if provider, err := iter.next(0); err != nil || provider.Name != "failing" {
+		t.Fatalf("Recovered provider must be used, but actual: %v err: %v", provider, err)
+	}
+}
+
+func TestIterTrialReserve(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{Name: "slow", URLPattern: "host0", MaxRate: 100},
+		{Name: "failing", URLPattern: "host1", MaxRate: 1},
+	})
+	if err := iter.SetStrategy(StrategyFastest); err != nil {
+		t.Fatal("Strategy err:", err)
+	}
+	slow, failing := &iter.blocks[0].provider, &iter.blocks[1].provider
+	for i := 0; i < 4; i++ {
+		iter.Report(failing, time.Hour, errors.New("failure"))
+	}
+	now := iter.blocks[1].health.probe + probeInterval
+
+	// trial isn't reserved by excluded provider
+	if provider, err := iter.nextExcept(now, failing); err != nil || provider != slow {
+		t.Fatalf("Excluded provider must be skipped, but actual: %v err: %v", provider, err)
+	}
+	if provider, err := iter.next(now); err != nil || provider != failing {
+		t.Fatalf("Trial must be reserved by returned provider, but actual: %v err: %v", provider, err)
+	}
+
+	// trial isn't reserved by busy provider (previous trial is counted for the last minute)
+	now += probeInterval
+	if provider, err := iter.next(now); err != nil || provider != slow {
+		t.Fatalf("Busy provider must be skipped, but actual: %v err: %v", provider, err)
+	}
+	if !iter.blocks[1].health.due(now) {
+		t.Fatal("Trial of busy provider mustn't be reserved")
+	}
+}
+
+func TestLatencyFailing(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{Name: "failing", URLPattern: "host0", MaxRate: 100},
+		{Name: "slow", URLPattern: "host1", MaxRate: 100},
+	})
+	if err := iter.SetStrategy(StrategyLatency); err != nil {
+		t.Fatal("Strategy err:", err)
+	}
+
+	// provider without successful requests is the last one
+	iter.Report(&iter.blocks[0].provider, time.Millisecond, errors.New("failure"))
+	iter.Report(&iter.blocks[1].provider, time.Second, nil)
+	if provider, err := iter.next(0); err != nil || provider.Name != "slow" {
+		t.Fatalf("Must be provider: `slow`, but actual: %v err: %v", provider, err)
+	}
+}
+
+func TestWindowQuantile(t *testing.T) {
+	t.Parallel()
+
+	var w window
+	if _, ok := w.quantile(0.5); ok {
+		t.Fatal("Quantile of empty window")
+	}
+
+	// only latest windowSize samples are kept
+	for i := int64(1); i <= 2*windowSize; i++ {
+		w.observe(i)
+	}
+	cases := []struct {
+		Q     float64
+		Value int64
+	}{
+		{Q: 0, Value: windowSize + 1},
+		{Q: 0.5, Value: windowSize + windowSize/2},
+		{Q: 0.95, Value: windowSize + 122},
+		{Q: 1, Value: 2 * windowSize},
+	}
+	for _, testCase := range cases {
+		if value, ok := w.quantile(testCase.Q); !ok || value != testCase.Value {
+			t.Fatalf("Quantile [%v]: expected: %v, but %v", testCase.Q, testCase.Value, value)
+		}
+	}
+}
+
+func TestIterQuantile(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{{Name: "host0", MaxRate: 4}})
+	provider := &iter.blocks[0].provider
+	if _, ok := iter.Quantile(provider, 0.9); ok {
+		t.Fatal("Quantile without requests")
+	}
+
+	// failed requests aren't taken into account
+	iter.Report(provider, time.Millisecond, nil)
+	iter.Report(provider, time.Hour, errors.New("failure"))
+	if latency, ok := iter.Quantile(provider, 0.9); !ok || latency != time.Millisecond {
+		t.Fatalf("Invalid quantile: expected: %v, but %v", time.Millisecond, latency)
+	}
+}
@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+)
+
+// strategy names
+const (
+	StrategySticky   = "sticky"   // current provider until it's busy
+	StrategyPriority = "priority" // first not busy provider in config order
+	StrategyWeighted = "weighted" // weighted round-robin
+	StrategyLeast    = "least"    // least utilized (lowest rate / max_rate)
+	StrategyLatency  = "latency"  // lowest EWMA of latency
+	StrategyFastest  = "fastest"  // lowest EWMA of latency among healthy providers
+	StrategyRandom   = "random"
+)
+
+// Strategy - order, in which iterator checks capacity of providers
+type Strategy interface {
+	// order returns indexes of iterator blocks
+	order(iter *Iterator, now int64) []int
+}
+
+// NewStrategy returns strategy by name for providers of iterator
+func NewStrategy(name string, providers []Provider) (Strategy, error) {
+	switch name {
+	case StrategySticky, "":
+		return sticky{}, nil
+	case StrategyPriority:
+		return priority{}, nil
+	case StrategyWeighted:
+		return newWeighted(providers), nil
+	case StrategyLeast:
+		return least{}, nil
+	case StrategyLatency:
+		return latency{}, nil
+	case StrategyFastest:
+		return fastest{}, nil
+	case StrategyRandom:
+		return random{}, nil
+	}
+	return nil, errors.New("Unknown strategy `" + name + "`")
+}
+
+// sequence returns indexes from first to last, then from 0 to first
+func sequence(first, n int) []int {
+	order := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		order = append(order, (first+i)%n)
+	}
+	return order
+}
+
+type sticky struct{}
+
+func (sticky) order(iter *Iterator, now int64) []int {
+	return sequence(int(atomic.LoadInt32(&iter.index)), len(iter.blocks))
+}
+
+type priority struct{}
+
+func (priority) order(iter *Iterator, now int64) []int {
+	return sequence(0, len(iter.blocks))
+}
+
+// weighted - smooth weighted round-robin, next provider is taken from precomputed schedule
+type weighted struct {
+	schedule []int
+	counter  *uint32
+}
+
+func newWeighted(providers []Provider) weighted {
+	weights, total := make([]int, len(providers)), 0
+	for i := range providers {
+		if weights[i] = providers[i].Weight; weights[i] <= 0 {
+			weights[i] = 1
+		}
+		total += weights[i]
+	}
+
+	schedule, current := make([]int, 0, total), make([]int, len(weights))
+	for len(schedule) < total {
+		best := 0
+		for i := range weights {
+			if current[i] += weights[i]; current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		schedule = append(schedule, best)
+	}
+	return weighted{schedule: schedule, counter: new(uint32)}
+}
+
+func (w weighted) order(iter *Iterator, now int64) []int {
+	if len(w.schedule) == 0 {
+		return nil
+	}
+
+	first := w.schedule[(atomic.AddUint32(w.counter, 1)-1)%uint32(len(w.schedule))]
+	order := []int{first}
+	for i := range iter.blocks {
+		if i != first {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// sortBy returns indexes of blocks sorted by key in ascending order
+func sortBy(iter *Iterator, key func(block *ProvBlock) float64) []int {
+	keys, order := make([]float64, len(iter.blocks)), sequence(0, len(iter.blocks))
+	for i := range iter.blocks {
+		keys[i] = key(&iter.blocks[i])
+	}
+	sort.SliceStable(order, func(i, j int) bool { return keys[order[i]] < keys[order[j]] })
+	return order
+}
+
+type least struct{}
+
+func (least) order(iter *Iterator, now int64) []int {
+	return sortBy(iter, func(block *ProvBlock) float64 {
+		if block.provider.MaxRate <= 0 {
+			return 1
+		}
+		return float64(iter.rate(block, now)) / float64(block.provider.MaxRate)
+	})
+}
+
+type latency struct{}
+
+func (latency) order(iter *Iterator, now int64) []int {
+	return sortBy(iter, func(block *ProvBlock) float64 {
+		return block.health.estimate()
+	})
+}
+
+// fastest - unhealthy providers are used only if all healthy ones are busy,
+// except of trial requests, which make them healthy if they succeed
+type fastest struct{}
+
+func (fastest) order(iter *Iterator, now int64) []int {
+	return sortBy(iter, func(block *ProvBlock) float64 {
+		if block.health.healthy() {
+			return block.health.estimate()
+		}
+		if block.health.due(now) { // trial is reserved by iterator, only if block is returned
+			return math.Inf(-1)
+		}
+		return math.Inf(1)
+	})
+}
+
+type random struct{}
+
+func (random) order(iter *Iterator, now int64) []int {
+	return rand.Perm(len(iter.blocks))
+}
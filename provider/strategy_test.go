@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStrategies(t *testing.T) {
+	t.Parallel()
+
+	type step struct {
+		Now        int64
+		URLPattern string // empty if all providers are busy
+	}
+	cases := []struct {
+		Strategy  string
+		Providers []Provider
+		Latencies []time.Duration
+		Steps     []step
+	}{
+		{
+			Strategy:  StrategySticky,
+			Providers: []Provider{{URLPattern: "host0", MaxRate: 1}, {URLPattern: "host1", MaxRate: 2}},
+			Steps:     []step{{0, "host0"}, {0, "host1"}, {61, "host1"}, {61, "host1"}, {61, "host0"}},
+		},
+		{
+			Strategy:  StrategyPriority,
+			Providers: []Provider{{URLPattern: "host0", MaxRate: 1}, {URLPattern: "host1", MaxRate: 2}},
+			Steps:     []step{{0, "host0"}, {0, "host1"}, {61, "host0"}, {61, "host1"}, {61, "host1"}, {61, ""}},
+		},
+		{
+			Strategy: StrategyWeighted,
+			Providers: []Provider{
+				{URLPattern: "host0", MaxRate: 8, Weight: 2},
+				{URLPattern: "host1", MaxRate: 1},
+			},
+			Steps: []step{{0, "host0"}, {0, "host1"}, {0, "host0"}, {0, "host0"}, {0, "host0"}, {0, "host0"}},
+		},
+		{
+			Strategy:  StrategyLeast,
+			Providers: []Provider{{URLPattern: "host0", MaxRate: 4}, {URLPattern: "host1", MaxRate: 2}},
+			Steps: []step{
+				{0, "host0"}, {0, "host1"}, {0, "host0"}, {0, "host0"}, {0, "host1"}, {0, "host0"}, {0, ""},
+			},
+		},
+		{
+			Strategy: StrategyLatency,
+			Providers: []Provider{
+				{URLPattern: "host0", MaxRate: 1},
+				{URLPattern: "host1", MaxRate: 1},
+				{URLPattern: "host2", MaxRate: 1},
+			},
+			Latencies: []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond},
+			Steps:     []step{{0, "host1"}, {0, "host2"}, {0, "host0"}, {0, ""}},
+		},
+	}
+
+	for _, testCase := range cases {
+		iter := NewIterator(testCase.Providers)
+		if err := iter.SetStrategy(testCase.Strategy); err != nil {
+			t.Fatalf("Strategy [%v]: err: %v", testCase.Strategy, err)
+		}
+		for i, latency := range testCase.Latencies {
+			iter.Report(&iter.blocks[i].provider, latency, nil)
+		}
+
+		for i, step := range testCase.Steps {
+			provider, err := iter.next(step.Now)
+			if step.URLPattern == "" {
+				if err != ErrNotFound {
+					t.Fatalf("Strategy [%v]: iteration [%v]: must be err: %v, but actual: %v err: %v",
+						testCase.Strategy, i, ErrNotFound, provider, err)
+				}
+				continue
+			}
+			if err != nil || provider.URLPattern != step.URLPattern {
+				t.Fatalf("Strategy [%v]: iteration [%v]: must be host: `%v`, but actual: %v err: %v",
+					testCase.Strategy, i, step.URLPattern, provider, err)
+			}
+		}
+	}
+}
+
+func TestStrategyRandom(t *testing.T) {
+	t.Parallel()
+
+	iter := NewIterator([]Provider{
+		{URLPattern: "host0", MaxRate: 1},
+		{URLPattern: "host1", MaxRate: 1},
+		{URLPattern: "host2", MaxRate: 1},
+	})
+	if err := iter.SetStrategy(StrategyRandom); err != nil {
+		t.Fatal("Strategy err:", err)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		provider, err := iter.next(0)
+		if err != nil || seen[provider.URLPattern] {
+			t.Fatalf("Iteration [%v]: must be new provider, but actual: %v err: %v", i, provider, err)
+		}
+		seen[provider.URLPattern] = true
+	}
+	if provider, err := iter.next(0); err != ErrNotFound {
+		t.Fatalf("All providers are busy, but actual: %v err: %v", provider, err)
+	}
+
+	if err := iter.SetStrategy("unknown"); err == nil {
+		t.Fatal("Unknown strategy must return err")
+	}
+}
@@ -0,0 +1,224 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// conn - connection to server
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// Client - client of Redis-protocol server with pool of idle connections
+type Client struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration // dial & IO timeout
+
+	mu      sync.Mutex
+	idle    []*conn
+	maxIdle int
+}
+
+// NewClient - constructor for Client struct
+func NewClient(addr, password string, db int, timeout time.Duration, maxIdle int) *Client {
+	return &Client{
+		addr:     addr,
+		password: password,
+		db:       db,
+		timeout:  timeout,
+		maxIdle:  maxIdle,
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+
+	if c.password != "" {
+		if _, err := c.do(ctx, cn, "AUTH", c.password); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.do(ctx, cn, "SELECT", strconv.Itoa(c.db)); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	if len(c.idle) < c.maxIdle {
+		c.idle = append(c.idle, cn)
+		cn = nil
+	}
+	c.mu.Unlock()
+
+	if cn != nil {
+		cn.Close()
+	}
+}
+
+// do sends command by cn with deadline of IO (the earliest of timeout & deadline of ctx),
+// cancellation of ctx interrupts IO
+func (c *Client) do(ctx context.Context, cn *conn, args ...string) (interface{}, error) {
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	cn.SetDeadline(deadline) // zero deadline resets one of previous command
+
+	if done := ctx.Done(); done != nil {
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				cn.SetDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+		// idle connection mustn't be interrupted later
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+	}
+
+	var reply interface{}
+	err := WriteCommand(cn.w, args...)
+	if err == nil {
+		reply, err = ReadReply(cn.r)
+	}
+	if err != nil {
+		if ctx.Err() != nil { // IO is interrupted by ctx
+			return nil, ctx.Err()
+		}
+		if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) { // timer of ctx may fire after one of IO
+			return nil, context.DeadlineExceeded
+		}
+		return nil, err
+	}
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// Do sends command and returns its reply (Error replies are returned as error)
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(ctx, cn, args...)
+	if _, ok := err.(Error); err != nil && !ok {
+		// connection is broken
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Get returns value of key, ok is false if key doesn't exist
+func (c *Client) Get(ctx context.Context, key string) (value string, ok bool, err error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	value, ok = reply.(string)
+	if !ok {
+		return "", false, errors.New("RESP: GET: unexpected reply type")
+	}
+	return value, true, nil
+}
+
+// Set sets value of key with ttl (in milliseconds precision)
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ms := ttl.Milliseconds(); ms > 0 {
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del deletes key
+func (c *Client) Del(ctx context.Context, key string) error {
+	_, err := c.Do(ctx, "DEL", key)
+	return err
+}
+
+// Scan returns keys matching glob pattern by one step of iteration from cursor ("0" starts iteration),
+// iteration is over if next cursor is "0"
+func (c *Client) Scan(ctx context.Context, cursor, match string, count int) (next string, keys []string, err error) {
+	reply, err := c.Do(ctx, "SCAN", cursor, "MATCH", match, "COUNT", strconv.Itoa(count))
+	if err != nil {
+		return "", nil, err
+	}
+	array, ok := reply.([]interface{})
+	if !ok || len(array) != 2 {
+		return "", nil, errors.New("RESP: SCAN: unexpected reply type")
+	}
+	next, ok = array[0].(string)
+	items, okItems := array[1].([]interface{})
+	if !ok || !okItems {
+		return "", nil, errors.New("RESP: SCAN: unexpected reply type")
+	}
+	keys = make([]string, 0, len(items))
+	for _, item := range items {
+		key, ok := item.(string)
+		if !ok {
+			return "", nil, errors.New("RESP: SCAN: unexpected reply type")
+		}
+		keys = append(keys, key)
+	}
+	return next, keys, nil
+}
+
+// Close closes all idle connections
+func (c *Client) Close() {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.mu.Unlock()
+
+	for _, cn := range idle {
+		cn.Close()
+	}
+}
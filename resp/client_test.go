@@ -0,0 +1,306 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// server - in-process stand-in of Redis server (GET, SET [PX], DEL, SCAN, AUTH),
+// SCAN returns all matching keys at once
+type server struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	deadline map[string]time.Time
+}
+
+func newServer(t *testing.T, password string) *server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen err:", err)
+	}
+	s := &server{
+		listener: listener,
+		password: password,
+		values:   map[string]string{},
+		deadline: map[string]time.Time{},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *server) Close() {
+	s.listener.Close()
+}
+
+func (s *server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	authorized := s.password == ""
+	for {
+		reply, err := ReadReply(r)
+		if err != nil {
+			return
+		}
+		array, _ := reply.([]interface{})
+		args := make([]string, 0, len(array))
+		for _, arg := range array {
+			str, _ := arg.(string)
+			args = append(args, str)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		var resp string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH" && len(args) == 2:
+			if authorized = args[1] == s.password; authorized {
+				resp = "+OK\r\n"
+			} else {
+				resp = "-ERR invalid password\r\n"
+			}
+		case !authorized:
+			resp = "-NOAUTH Authentication required.\r\n"
+		case cmd == "GET" && len(args) == 2:
+			if value, ok := s.get(args[1]); ok {
+				resp = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			} else {
+				resp = "$-1\r\n"
+			}
+		case cmd == "SET" && (len(args) == 3 || len(args) == 5 && strings.ToUpper(args[3]) == "PX"):
+			var ttl time.Duration
+			if len(args) == 5 {
+				ms, _ := strconv.Atoi(args[4])
+				ttl = time.Duration(ms) * time.Millisecond
+			}
+			s.set(args[1], args[2], ttl)
+			resp = "+OK\r\n"
+		case cmd == "DEL" && len(args) == 2:
+			s.mu.Lock()
+			delete(s.values, args[1])
+			s.mu.Unlock()
+			resp = ":1\r\n"
+		case cmd == "SCAN" && len(args) == 6 && strings.ToUpper(args[2]) == "MATCH":
+			var keys []string
+			s.mu.Lock()
+			for key := range s.values {
+				if ok, _ := path.Match(args[3], key); ok {
+					keys = append(keys, "$"+strconv.Itoa(len(key))+"\r\n"+key+"\r\n")
+				}
+			}
+			s.mu.Unlock()
+			resp = "*2\r\n$1\r\n0\r\n*" + strconv.Itoa(len(keys)) + "\r\n" + strings.Join(keys, "")
+		default:
+			resp = "-ERR unknown command\r\n"
+		}
+		w.WriteString(resp)
+		w.Flush()
+	}
+}
+
+func (s *server) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if deadline, ok := s.deadline[key]; ok && time.Now().After(deadline) {
+		delete(s.values, key)
+		delete(s.deadline, key)
+	}
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func (s *server) set(key, value string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	delete(s.deadline, key)
+	if ttl > 0 {
+		s.deadline[key] = time.Now().Add(ttl)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Input string
+		Reply string
+	}{
+		{Input: "+OK\r\n", Reply: "OK"},
+		{Input: "-ERR wrong\r\n", Reply: "ERR wrong"},
+		{Input: ":42\r\n", Reply: "42"},
+		{Input: "$5\r\nhello\r\n", Reply: "hello"},
+		{Input: "$-1\r\n", Reply: "<nil>"},
+		{Input: "*2\r\n$1\r\na\r\n:1\r\n", Reply: "[a 1]"},
+	}
+	for i, testCase := range cases {
+		reply, err := ReadReply(bufio.NewReader(strings.NewReader(testCase.Input)))
+		if err != nil {
+			t.Fatalf("Case [%v]: unexpected err: %v", i, err)
+		}
+		if str := toString(reply); str != testCase.Reply {
+			t.Fatalf("Case [%v]: expected: %v, but %v", i, testCase.Reply, str)
+		}
+	}
+
+	for _, input := range []string{"", "?\r\n", "$3\r\nab\r\n", "+OK\n", ":x\r\n"} {
+		if reply, err := ReadReply(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Fatalf("Input %q: must be err, but %v", input, reply)
+		}
+	}
+}
+
+func toString(reply interface{}) string {
+	switch value := reply.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		return value
+	case Error:
+		return string(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case []interface{}:
+		elems := make([]string, 0, len(value))
+		for _, elem := range value {
+			elems = append(elems, toString(elem))
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	}
+	return "?"
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv := newServer(t, "secret")
+	defer srv.Close()
+
+	client := NewClient(srv.Addr(), "secret", 0, time.Second, 2)
+	defer client.Close()
+
+	if value, ok, err := client.Get(ctx, "key"); err != nil || ok {
+		t.Fatalf("Get of missed key: expected: miss, but %v %v err: %v", value, ok, err)
+	}
+	if err := client.Set(ctx, "key", "value", 0); err != nil {
+		t.Fatal("Set err:", err)
+	}
+	if value, ok, err := client.Get(ctx, "key"); err != nil || !ok || value != "value" {
+		t.Fatalf("Get: expected: value, but %v %v err: %v", value, ok, err)
+	}
+
+	if err := client.Set(ctx, "expired", "value", time.Millisecond); err != nil {
+		t.Fatal("Set err:", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if value, ok, err := client.Get(ctx, "expired"); err != nil || ok {
+		t.Fatalf("Get of expired key: expected: miss, but %v %v err: %v", value, ok, err)
+	}
+
+	if err := client.Del(ctx, "key"); err != nil {
+		t.Fatal("Del err:", err)
+	}
+	if value, ok, err := client.Get(ctx, "key"); err != nil || ok {
+		t.Fatalf("Get of deleted key: expected: miss, but %v %v err: %v", value, ok, err)
+	}
+
+	for _, key := range []string{"prefix:a", "prefix:b", "other"} {
+		if err := client.Set(ctx, key, "value", 0); err != nil {
+			t.Fatal("Set err:", err)
+		}
+	}
+	next, keys, err := client.Scan(ctx, "0", "prefix:*", 100)
+	sort.Strings(keys)
+	if err != nil || next != "0" || strings.Join(keys, ",") != "prefix:a,prefix:b" {
+		t.Fatalf("Scan: expected: prefix:a,prefix:b, but %v %v err: %v", next, keys, err)
+	}
+
+	if _, err := client.Do(ctx, "UNKNOWN"); err == nil {
+		t.Fatal("Unknown command must return err")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv := newServer(t, "secret")
+	client := NewClient(srv.Addr(), "wrong", 0, time.Second, 2)
+	if _, _, err := client.Get(ctx, "key"); err == nil {
+		t.Fatal("Invalid password must return err")
+	}
+
+	srv.Close()
+	client = NewClient(srv.Addr(), "secret", 0, 100*time.Millisecond, 2)
+	if _, _, err := client.Get(ctx, "key"); err == nil {
+		t.Fatal("Unreachable server must return err")
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	t.Parallel()
+
+	// server reads commands, but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen err:", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	// client without timeout waits for reply within ctx only
+	client := NewClient(listener.Addr().String(), "", 0, 0, 2)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := client.Get(ctx, "key"); err != context.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Fatalf("Get must fail at deadline, but err: %v in %v", err, time.Since(start))
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	if _, _, err := client.Get(ctx, "key"); err != context.Canceled || time.Since(start) > time.Second {
+		t.Fatalf("Get must fail at cancellation, but err: %v in %v", err, time.Since(start))
+	}
+}
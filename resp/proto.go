@@ -0,0 +1,101 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Error - error reply of server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+var (
+	// ErrProtocol ...
+	ErrProtocol = errors.New("RESP: protocol error")
+)
+
+// WriteCommand writes command as array of bulk strings
+func WriteCommand(w *bufio.Writer, args ...string) error {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(len(args)))
+	w.WriteString("\r\n")
+	for _, arg := range args {
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(arg)))
+		w.WriteString("\r\n")
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+	return w.Flush()
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", ErrProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// ReadReply reads one reply, its type is string, int64, []interface{},
+// nil (null bulk string or array) or Error
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, ErrProtocol
+	}
+
+	switch kind, payload := line[0], line[1:]; kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return Error(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < -1 {
+			return nil, ErrProtocol
+		}
+		if size == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, ErrProtocol
+		}
+		return string(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < -1 {
+			return nil, ErrProtocol
+		}
+		if size == -1 {
+			return nil, nil
+		}
+		array := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			elem, err := ReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, elem)
+		}
+		return array, nil
+	}
+	return nil, ErrProtocol
+}
@@ -6,33 +6,101 @@ import (
 	"errors"
 	"flag"
 	"log"
-	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/searchinform/batch"
 	"github.com/searchinform/cache"
+	"github.com/searchinform/cluster"
+	"github.com/searchinform/dns"
 	"github.com/searchinform/provider"
 )
 
 var (
-	configPath string
+	configPath   string
+	snapshotPath string
 )
 
 func init() {
 	flag.StringVar(&configPath, "c", "conf.json", "config filepath")
+	flag.StringVar(&snapshotPath, "warm", "", "cache snapshot filepath (ndjson or csv) for pre-warming")
 }
 
 // Controller - main struct with all dependences
 type Controller struct {
-	cache     cache.Cache
-	providers provider.Iterator
-	client    HTTPClient
-	logger    log.Logger
+	cache       cache.Cache[string, string]
+	consensuses cache.Cache[string, Consensus] // separate from single-provider answers
+	hostnames   cache.Cache[string, string]    // forward-confirmed names of addrs ("" if there is none)
+	l2          *L2
+	peers       *Peers
+	gossip      *cluster.Gossip
+	hedger      *Hedger
+	resolver    *dns.Cache
+	batchers    map[*provider.Provider]*batch.Batcher[string, *answer]
+	providers   provider.Iterator
+	client      HTTPClient
+	logger      log.Logger
+
+	refreshConf  RefreshConfig
+	adminToken   string
+	gossipPeriod time.Duration
+	stateConf    StateConfig
 }
 
 // Init run all background jobs
 func (ctrl *Controller) Init() {
 	go cache.Cleaner(context.Background(), &ctrl.cache)
+	go cache.Cleaner(context.Background(), &ctrl.consensuses)
+	go cache.Cleaner(context.Background(), &ctrl.hostnames)
+	go ctrl.l2.Run(context.Background())
+	go ctrl.resolver.Run(context.Background())
+
+	if path := ctrl.stateConf.Path; path != "" {
+		if err := ctrl.providers.Restore(path); err != nil {
+			ctrl.logger.Printf("Restore provider rates from [%v]: err : %v", path, err)
+		}
+		if period := ctrl.stateConf.Period.Duration; period > 0 {
+			go ctrl.checkpointer(context.Background(), path, period)
+		}
+	}
+
+	if conf := ctrl.refreshConf; conf.Period.Duration > 0 {
+		go cache.Refresher(context.Background(), &ctrl.cache, conf.Period.Duration, conf.Ahead.Duration, ctrl.refresh)
+	}
+
+	if ctrl.gossip != nil {
+		go ctrl.gossip.Run(context.Background(), ctrl.gossipPeriod, ctrl.providers.History)
+	}
+}
+
+// checkpointer - goroutine, which saves provider rates every period
+func (ctrl *Controller) checkpointer(ctx context.Context, path string, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ctrl.providers.Checkpoint(path); err != nil {
+				ctrl.logger.Printf("Checkpoint provider rates to [%v]: err : %v", path, err)
+			}
+		}
+	}
+}
+
+// Close saves state before shutdown
+func (ctrl *Controller) Close() {
+	if path := ctrl.stateConf.Path; path != "" {
+		if err := ctrl.providers.Checkpoint(path); err != nil {
+			ctrl.logger.Printf("Checkpoint provider rates to [%v]: err : %v", path, err)
+		}
+	}
 }
 
 func (ctrl *Controller) error(w http.ResponseWriter, msg string, code int) {
@@ -40,8 +108,9 @@ func (ctrl *Controller) error(w http.ResponseWriter, msg string, code int) {
 	http.Error(w, msg, code)
 }
 
-func lookup(host string) (addr string, err error) {
-	addrs, err := net.LookupHost(host)
+// lookup returns the first addr of host
+func (ctrl *Controller) lookup(ctx context.Context, host string) (addr string, err error) {
+	addrs, err := ctrl.resolver.LookupHost(ctx, host)
 	if err != nil {
 		return "", err
 	}
@@ -51,32 +120,191 @@ func lookup(host string) (addr string, err error) {
 	return addrs[0], nil
 }
 
+// hostname returns forward-confirmed name of addr ("" if it has no one or lookup has failed)
+func (ctrl *Controller) hostname(ctx context.Context, addr string) string {
+	if hostname, ok := ctrl.hostnames.Get(addr); ok {
+		return hostname
+	}
+
+	hostname, ttl, err := ctrl.resolver.Hostname(ctx, addr)
+	switch err {
+	case nil, dns.ErrNotFound, dns.ErrNotConfirmed:
+		// name doesn't live longer than PTR & forward answers
+		if limit := ctrl.hostnames.TTL(cache.Origin{}); ttl > limit {
+			ttl = limit
+		}
+		if ttl > 0 {
+			ctrl.hostnames.InsertWithTTL(addr, hostname, cache.Origin{}, ttl)
+		}
+	default:
+		ctrl.logger.Printf("Reverse lookup of addr [%v] err : %v", addr, err)
+	}
+	return hostname
+}
+
+// cache tiers
+const (
+	tierL1   = "l1"
+	tierL2   = "l2"
+	tierPeer = "peer"
+)
+
+// Resolution - result of host resolving
+type Resolution struct {
+	Addr    string
+	Country string
+	Origin  cache.Origin
+	Tier    string // cache tier of answer (empty if answer is from provider)
+}
+
+// fetch returns country of addr from provider with origin of answer
+func (ctrl *Controller) fetch(ctx context.Context, provider *provider.Provider, addr string) (string, cache.Origin, error) {
+	start := time.Now()
+	country, err := ctrl.client.Resolve(ctx, provider, addr)
+	now := time.Now()
+	if ctx.Err() == nil { // cancelled request says nothing about provider
+		ctrl.report(provider, now.Sub(start), err)
+	}
+	return country, cache.Origin{Provider: provider.Name, Fetched: now.UnixNano(), Latency: now.Sub(start)}, err
+}
+
+// report registers result of request to provider
+func (ctrl *Controller) report(provider *provider.Provider, latency time.Duration, err error) {
+	if ctrl.providers.Report(provider, latency, err) {
+		ctrl.logger.Printf("Provider [%v]: key [%v] is disabled : %v", provider.Name, provider.Key, err)
+	}
+}
+
 // resolve returns country of this host
-func (ctrl *Controller) resolve(host string) (string, error) {
-	addr, err := lookup(host)
+func (ctrl *Controller) resolve(ctx context.Context, host string) (*Resolution, error) {
+	addr, err := ctrl.lookup(ctx, host)
+	if err != nil {
+		return nil, errors.New("host lookup err : " + err.Error())
+	}
+	return ctrl.resolveAddr(ctx, host, addr, true)
+}
+
+// resolveAddr returns country of addr, miss is forwarded to owner replica if forward is true
+func (ctrl *Controller) resolveAddr(ctx context.Context, host, addr string, forward bool) (*Resolution, error) {
+	if entry, ok := ctrl.cache.Lookup(addr); ok {
+		res := &Resolution{Addr: addr, Country: entry.Value(), Origin: entry.Origin(), Tier: tierL1}
+		ctrl.logger.Printf("Resolve [%v]: addr [%v]: cache hit: provider [%v]: country is `%v`",
+			host, addr, res.Origin.Provider, res.Country)
+		return res, nil
+	}
+
+	if country, origin, ttl, ok := ctrl.l2.Get(ctx, addr); ok {
+		// answer of L2 doesn't live longer in L1 than in L2
+		if limit := ctrl.cache.TTL(origin); ttl <= 0 || ttl > limit {
+			ttl = limit
+		}
+		ctrl.cache.InsertWithTTL(addr, country, origin, ttl)
+		ctrl.logger.Printf("Resolve [%v]: addr [%v]: L2 hit: provider [%v]: country is `%v`",
+			host, addr, origin.Provider, country)
+		return &Resolution{Addr: addr, Country: country, Origin: origin, Tier: tierL2}, nil
+	}
+
+	if owner, remote := ctrl.peers.Owner(addr); forward && remote {
+		country, origin, ttl, err := ctrl.peers.Resolve(ctx, owner, addr)
+		if err == nil {
+			// answer of peer doesn't live longer here than in cache of owner
+			if limit := ctrl.cache.TTL(origin); ttl == 0 || ttl > limit {
+				ttl = limit
+			}
+			ctrl.cache.InsertWithTTL(addr, country, origin, ttl)
+			ctrl.logger.Printf("Resolve [%v]: addr [%v]: peer [%v]: provider [%v]: country is `%v`",
+				host, addr, owner, origin.Provider, country)
+			return &Resolution{Addr: addr, Country: country, Origin: origin, Tier: tierPeer}, nil
+		}
+		ctrl.logger.Printf("Resolve [%v]: addr [%v]: peer [%v] err : %v, resolve locally", host, addr, owner, err)
+	}
+
+	// client, which has gone, doesn't consume quota of providers
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	counted := time.Now().Unix() // second, in which request to provider is counted
+	provider, err := ctrl.providers.NextAt(counted)
 	if err != nil {
-		return "", errors.New("host lookup err : " + err.Error())
+		return nil, errors.New("providers iter err : " + err.Error())
 	}
 
-	if country, ok := ctrl.cache.Get(addr); ok {
-		ctrl.logger.Printf("Resolve [%v]: addr [%v]: cache hit: country is `%v`", host, addr, country)
-		return country, nil
+	var ans *answer
+	if b := ctrl.batchers[provider]; b != nil {
+		ans = ctrl.fetchBatch(ctx, b, provider, addr, counted)
+	} else {
+		ans = ctrl.fetchFirst(ctx, host, addr, provider)
 	}
+	if ans.err != nil {
+		return nil, errors.New("http client err : " + ans.err.Error())
+	}
+
+	ctrl.cache.InsertFrom(addr, ans.country, ans.origin)
+	ctrl.l2.Enqueue(addr, ans.country, ans.origin)
 
-	provider, err := ctrl.providers.Next()
+	ctrl.logger.Printf("Resolve [%v]: addr [%v]: provider [%v]: latency %v: country `%v`",
+		host, addr, ans.provider.Name, ans.origin.Latency, ans.country)
+	return &Resolution{Addr: addr, Country: ans.country, Origin: ans.origin}, nil
+}
+
+// refresh re-resolves addr using only spare capacity of providers
+func (ctrl *Controller) refresh(addr string) (string, cache.Origin, bool) {
+	provider, err := ctrl.providers.Spare(ctrl.refreshConf.Fraction)
 	if err != nil {
-		return "", errors.New("providers iter err : " + err.Error())
+		return "", cache.Origin{}, false
 	}
 
-	country, err := ctrl.client.Resolve(provider, addr)
+	country, origin, err := ctrl.fetch(context.Background(), provider, addr)
 	if err != nil {
-		return "", errors.New("http client err : " + err.Error())
+		ctrl.logger.Printf("Refresh addr [%v]: provider [%v]: http client err : %v", addr, provider.Name, err)
+		return "", cache.Origin{}, false
 	}
 
-	ctrl.cache.Insert(addr, country)
+	ctrl.l2.Enqueue(addr, country, origin)
+
+	ctrl.logger.Printf("Refresh addr [%v]: provider [%v]: latency %v: country `%v`", addr, provider.Name, origin.Latency, country)
+	return country, origin, true
+}
+
+// TimeoutHeader - header with per-request deadline of resolving (e.g. `500ms`)
+const TimeoutHeader = "X-Request-Timeout"
+
+// requestContext returns context of request with deadline from `timeout` parameter
+// or TimeoutHeader (if any of them is set)
+func requestContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout := r.FormValue("timeout")
+	if timeout == "" {
+		timeout = r.Header.Get(TimeoutHeader)
+	}
+	if timeout == "" {
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d <= 0 {
+		return nil, nil, errors.New("invalid timeout `" + timeout + "`")
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), d)
+	return ctx, cancel, nil
+}
+
+// errorCode returns status code of failed resolving with ctx
+func errorCode(ctx context.Context) int {
+	if ctx.Err() == context.DeadlineExceeded {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
 
-	ctrl.logger.Printf("Resolve [%v]: addr [%v]: provider [%v]: country `%v`", host, addr, provider.Name, country)
-	return country, nil
+// details of resolution for verbose responses
+type details struct {
+	Addr     string    `json:"addr"`
+	Provider string    `json:"provider"`
+	Fetched  time.Time `json:"fetched"`
+	Latency  Duration  `json:"latency"`
+	Cached   bool      `json:"cached"`
+	Tier     string    `json:"tier,omitempty"`
 }
 
 // CountryByIP ..
@@ -86,16 +314,45 @@ func (ctrl *Controller) CountryByIP(w http.ResponseWriter, r *http.Request) {
 		host = r.Host
 	}
 
-	country, err := ctrl.resolve(host)
+	if n, _ := strconv.Atoi(r.FormValue("consensus")); n > 1 {
+		ctrl.countryByConsensus(w, r, host, n)
+		return
+	}
+
+	ctx, cancel, err := requestContext(r)
 	if err != nil {
-		ctrl.error(w, "Resolve err: "+err.Error(), http.StatusInternalServerError)
+		ctrl.error(w, "Resolve err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	res, err := ctrl.resolve(ctx, host)
+	if err != nil {
+		ctrl.error(w, "Resolve err: "+err.Error(), errorCode(ctx))
 		return
 	}
 
 	body := &struct {
-		Host    string `json:"host"`
-		Country string `json:"country"`
-	}{Host: host, Country: country}
+		Host     string `json:"host"`
+		Country  string `json:"country"`
+		Hostname string `json:"hostname,omitempty"`
+		*details
+	}{Host: host, Country: res.Country}
+
+	if rdns, _ := strconv.ParseBool(r.FormValue("rdns")); rdns {
+		body.Hostname = ctrl.hostname(ctx, res.Addr)
+	}
+
+	if verbose, _ := strconv.ParseBool(r.FormValue("verbose")); verbose {
+		body.details = &details{
+			Addr:     res.Addr,
+			Provider: res.Origin.Provider,
+			Fetched:  time.Unix(0, res.Origin.Fetched),
+			Latency:  Duration{res.Origin.Latency},
+			Cached:   res.Tier != "",
+			Tier:     res.Tier,
+		}
+	}
 
 	json.NewEncoder(w).Encode(body)
 }
@@ -103,6 +360,13 @@ func (ctrl *Controller) CountryByIP(w http.ResponseWriter, r *http.Request) {
 func main() {
 	flag.Parse()
 
+	if flag.Arg(0) == "cache" {
+		if err := cacheCommand(flag.Args()[1:]); err != nil {
+			log.Fatalln("Cache command err:", err)
+		}
+		return
+	}
+
 	log.Println("Parsing config file", configPath)
 	conf, err := ParseConfig(configPath)
 	if err != nil {
@@ -112,12 +376,41 @@ func main() {
 	ctrl := NewFactory(conf).NewController()
 	ctrl.Init()
 
+	if snapshotPath != "" {
+		n, err := loadSnapshot(&ctrl.cache, snapshotPath)
+		if err != nil {
+			log.Fatalln("Load snapshot err:", err)
+		}
+		log.Printf("Loaded %v cache entries from %v\n", n, snapshotPath)
+	}
+
 	router := http.NewServeMux()
 	router.HandleFunc("/api/country", ctrl.CountryByIP)
+	router.HandleFunc("/internal/resolve", ctrl.PeerResolve)
+	router.HandleFunc("/internal/rates", ctrl.PeerRates)
+	router.HandleFunc("/admin/cache/export", ctrl.admin(ctrl.ExportCache))
+	router.HandleFunc("/admin/cache/import", ctrl.admin(ctrl.ImportCache))
+	router.HandleFunc("/admin/cache/entry", ctrl.admin(ctrl.CacheEntry))
+	router.HandleFunc("/admin/cache/purge", ctrl.admin(ctrl.PurgeCache))
+	router.HandleFunc("/admin/cache/flush", ctrl.admin(ctrl.FlushCache))
+	router.HandleFunc("/admin/providers", ctrl.admin(ctrl.ProviderStats))
+
+	server := &http.Server{Addr: ":" + strconv.Itoa(conf.HTTP.Port), Handler: router}
+	go func() {
+		log.Printf("Server start on %v port...\n", conf.HTTP.Port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln("ListenAndServe err:", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	log.Println("Shutdown on signal", <-signals)
 
-	port := conf.HTTP.Port
-	log.Printf("Server start on %v port...\n", port)
-	if err := http.ListenAndServe(":"+strconv.Itoa(port), router); err != nil {
-		log.Fatalln("ListenAndServe err:", err)
+	ctx, cancel := context.WithTimeout(context.Background(), conf.HTTP.Timeout.Duration)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Shutdown err:", err)
 	}
+	ctrl.Close()
 }
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/searchinform/dns"
+	"github.com/searchinform/provider"
+)
+
+// stub - in-process geo provider, which answers country after delay
+type stub struct {
+	*httptest.Server
+	requests  int64
+	cancelled int64 // requests cancelled by client before answer
+}
+
+func newStub(t *testing.T, country string, delay time.Duration) *stub {
+	t.Helper()
+
+	s := &stub{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.requests, 1)
+		select {
+		case <-r.Context().Done():
+			atomic.AddInt64(&s.cancelled, 1)
+			return
+		case <-time.After(delay):
+		}
+		json.NewEncoder(w).Encode(map[string]string{"country": country})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stub) Requests() int64 {
+	return atomic.LoadInt64(&s.requests)
+}
+
+func (s *stub) Cancelled() int64 {
+	return atomic.LoadInt64(&s.cancelled)
+}
+
+// testConfig returns config with providers of stubs (their names are URLs of stubs)
+func testConfig(stubs ...*stub) *Config {
+	conf := &Config{}
+	conf.Cache.NPartitions = 4
+	conf.Cache.TTL = Duration{time.Minute}
+	conf.HTTP.Timeout = Duration{5 * time.Second}
+	conf.HTTP.DialTimeout = Duration{time.Second}
+	for _, s := range stubs {
+		conf.Providers = append(conf.Providers, provider.Provider{
+			Name:       s.URL,
+			Method:     http.MethodGet,
+			URLPattern: s.URL + "/%s",
+			Scheme:     []string{"country"},
+			MaxRate:    1000,
+		})
+	}
+	return conf
+}
+
+// newTestController returns controller by config without background jobs & logs
+func newTestController(t *testing.T, conf *Config) *Controller {
+	t.Helper()
+
+	for i := range conf.Providers {
+		if err := conf.Providers[i].Compile(); err != nil {
+			t.Fatal("Compile err:", err)
+		}
+	}
+	ctrl := NewFactory(conf).NewController()
+	ctrl.logger = *log.New(io.Discard, "", 0)
+	return ctrl
+}
+
+func TestRequestContext(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Query   string
+		Header  string
+		Timeout time.Duration // zero if there is no deadline
+		Err     bool
+	}{
+		{},
+		{Query: "timeout=100ms", Timeout: 100 * time.Millisecond},
+		{Header: "2s", Timeout: 2 * time.Second},
+		{Query: "timeout=100ms", Header: "2s", Timeout: 100 * time.Millisecond},
+		{Query: "timeout=abc", Err: true},
+		{Query: "timeout=0s", Err: true},
+		{Query: "timeout=-1s", Err: true},
+		{Header: "10", Err: true},
+	}
+	for i, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/country?"+testCase.Query, nil)
+		if testCase.Header != "" {
+			req.Header.Set(TimeoutHeader, testCase.Header)
+		}
+
+		start := time.Now()
+		ctx, cancel, err := requestContext(req)
+		if (err != nil) != testCase.Err {
+			t.Fatalf("Case [%v]: unexpected err: %v", i, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		deadline, ok := ctx.Deadline()
+		if ok != (testCase.Timeout != 0) {
+			t.Fatalf("Case [%v]: unexpected deadline: %v", i, deadline)
+		}
+		if ok && (deadline.Before(start.Add(testCase.Timeout)) || deadline.After(time.Now().Add(testCase.Timeout))) {
+			t.Fatalf("Case [%v]: timeout: expected: %v, but %v", i, testCase.Timeout, deadline.Sub(start))
+		}
+		if cancel(); ctx.Err() != context.Canceled {
+			t.Fatalf("Case [%v]: context isn't cancelled", i)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if code := errorCode(ctx); code != http.StatusGatewayTimeout {
+		t.Fatalf("Deadline: expected: %v, but %v", http.StatusGatewayTimeout, code)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if code := errorCode(ctx); code != http.StatusInternalServerError {
+		t.Fatalf("Cancelled: expected: %v, but %v", http.StatusInternalServerError, code)
+	}
+	if code := errorCode(context.Background()); code != http.StatusInternalServerError {
+		t.Fatalf("Failure: expected: %v, but %v", http.StatusInternalServerError, code)
+	}
+}
+
+func TestCountryByIPTimeout(t *testing.T) {
+	t.Parallel()
+
+	slow := newStub(t, "Belarus", 5*time.Second)
+	ctrl := newTestController(t, testConfig(slow))
+
+	cases := []struct {
+		Query  string
+		Header string
+		Code   int
+	}{
+		{Query: "&timeout=50ms", Code: http.StatusGatewayTimeout},
+		{Header: "50ms", Code: http.StatusGatewayTimeout},
+		{Query: "&timeout=50ms&consensus=2", Code: http.StatusGatewayTimeout},
+		{Query: "&timeout=fast", Code: http.StatusBadRequest},
+		{Query: "&timeout=fast&consensus=2", Code: http.StatusBadRequest},
+	}
+	for i, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/country?host=1.2.3."+strconv.Itoa(i)+testCase.Query, nil)
+		if testCase.Header != "" {
+			req.Header.Set(TimeoutHeader, testCase.Header)
+		}
+		w := httptest.NewRecorder()
+
+		start := time.Now()
+		ctrl.CountryByIP(w, req)
+		if w.Code != testCase.Code {
+			t.Fatalf("Case [%v]: status code: expected: %v, but %v (%v)", i, testCase.Code, w.Code, w.Body)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("Case [%v]: answer after timeout in %v", i, elapsed)
+		}
+	}
+
+	// requests to provider are cancelled by timeout, invalid timeouts don't request provider
+	waitFor(t, func() bool { return slow.Cancelled() == 3 })
+	if slow.Requests() != 3 {
+		t.Fatalf("Invalid number of provider requests: %v", slow.Requests())
+	}
+}
+
+func TestCountryByIPCancelled(t *testing.T) {
+	t.Parallel()
+
+	slow := newStub(t, "Belarus", 5*time.Second)
+	ctrl := newTestController(t, testConfig(slow))
+
+	// client, which has gone, doesn't request provider
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	ctrl.CountryByIP(w, httptest.NewRequest(http.MethodGet, "/api/country?host=1.2.3.4", nil).WithContext(ctx))
+	if w.Code != http.StatusInternalServerError || slow.Requests() != 0 {
+		t.Fatalf("Cancelled request: status code %v, %v provider requests", w.Code, slow.Requests())
+	}
+
+	// client, which goes away, stops provider request
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	w = httptest.NewRecorder()
+	start := time.Now()
+	ctrl.CountryByIP(w, httptest.NewRequest(http.MethodGet, "/api/country?host=1.2.3.4", nil).WithContext(ctx))
+	if elapsed := time.Since(start); w.Code != http.StatusInternalServerError || elapsed > 2*time.Second {
+		t.Fatalf("Cancelled request: status code %v in %v", w.Code, elapsed)
+	}
+	waitFor(t, func() bool { return slow.Cancelled() == 1 })
+	if slow.Requests() != 1 {
+		t.Fatalf("Invalid number of provider requests: %v", slow.Requests())
+	}
+}
+
+// names - fake DNS resolver with the same TTL of all answers
+type names struct {
+	addrs map[string][]string // by fully qualified host
+	names map[string][]string // by addr
+	ttl   time.Duration
+}
+
+func (n *names) LookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	if addrs, ok := n.addrs[host]; ok {
+		return addrs, n.ttl, nil
+	}
+	return nil, n.ttl, dns.ErrNotFound
+}
+
+func (n *names) LookupAddr(ctx context.Context, addr string) ([]string, time.Duration, error) {
+	if names, ok := n.names[addr]; ok {
+		return names, n.ttl, nil
+	}
+	return nil, n.ttl, dns.ErrNotFound
+}
+
+func TestCountryByIPHostname(t *testing.T) {
+	t.Parallel()
+
+	stubs := []*stub{newStub(t, "Belarus", 0), newStub(t, "Belarus", 0)}
+	ctrl := newTestController(t, testConfig(stubs...))
+	ctrl.resolver = dns.NewCache(&names{
+		addrs: map[string][]string{"host.example.com.": {"10.0.0.1"}, "other.example.com.": {"10.0.0.3"}},
+		names: map[string][]string{"10.0.0.1": {"host.example.com."}, "10.0.0.2": {"other.example.com."}},
+		ttl:   30 * time.Second,
+	}, 1, time.Minute, time.Minute, 0, 0)
+
+	cases := []struct {
+		Query    string
+		Hostname string
+	}{
+		{Query: "host=10.0.0.1&rdns=1", Hostname: "host.example.com"},
+		{Query: "host=10.0.0.1&rdns=1&consensus=2", Hostname: "host.example.com"},
+		{Query: "host=10.0.0.1"},
+		{Query: "host=10.0.0.2&rdns=1"}, // spoofed PTR
+		{Query: "host=10.0.0.4&rdns=true"},
+	}
+	for i, testCase := range cases {
+		w := httptest.NewRecorder()
+		ctrl.CountryByIP(w, httptest.NewRequest(http.MethodGet, "/api/country?"+testCase.Query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Case [%v]: invalid status code: %v body: %v", i, w.Code, w.Body)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("Case [%v]: decode err: %v", i, err)
+		}
+		if hostname, ok := body["hostname"]; ok != (testCase.Hostname != "") || (ok && hostname != testCase.Hostname) {
+			t.Fatalf("Case [%v]: hostname: expected: `%v`, but %v", i, testCase.Hostname, body)
+		}
+		if body["country"] != "Belarus" {
+			t.Fatalf("Case [%v]: invalid answer: %v", i, body)
+		}
+	}
+
+	// hostname doesn't live longer than DNS answers
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.4"} {
+		entry, ok := ctrl.hostnames.Peek(addr)
+		if !ok {
+			t.Fatalf("Addr [%v]: hostname isn't cached", addr)
+		}
+		if ttl := time.Duration(entry.Deadline() - time.Now().UnixNano()); ttl > 30*time.Second {
+			t.Fatalf("Addr [%v]: TTL of hostname is longer than TTL of DNS answers: %v", addr, ttl)
+		}
+	}
+}
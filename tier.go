@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/searchinform/cache"
+	"github.com/searchinform/resp"
+)
+
+// record - format of L2 values
+type record struct {
+	Country  string        `json:"country"`
+	Provider string        `json:"provider"`
+	Fetched  int64         `json:"fetched"` // in UnixNano
+	Latency  time.Duration `json:"latency"`
+	Deadline int64         `json:"deadline,omitempty"` // in UnixNano, zero if value doesn't expire
+	TTL      time.Duration `json:"ttl,omitempty"`      // remaining TTL of answer of peer (clocks of replicas may differ)
+}
+
+// write - queued write to L2
+type write struct {
+	addr    string
+	country string
+	origin  cache.Origin
+}
+
+// L2 - shared second tier of cache (Redis-protocol server), nil L2 is disabled tier
+type L2 struct {
+	client *resp.Client
+	prefix string
+	ttl    time.Duration
+	retry  time.Duration // pause after failure
+	logger *log.Logger
+
+	queue   chan write // writes after answers of providers
+	workers int        // number of writers of queue
+
+	down int64 // L2 is skipped until this time (in UnixNano)
+}
+
+// NewL2 - constructor for L2 struct, queue is size of queue of writes
+func NewL2(client *resp.Client, prefix string, ttl, retry time.Duration, queue, workers int, logger *log.Logger) *L2 {
+	return &L2{
+		client:  client,
+		prefix:  prefix,
+		ttl:     ttl,
+		retry:   retry,
+		logger:  logger,
+		queue:   make(chan write, queue),
+		workers: workers,
+	}
+}
+
+// Run - goroutine, which writes queued values by workers
+func (l *L2) Run(ctx context.Context) {
+	if l == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < l.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case w := <-l.queue:
+					l.Set(w.addr, w.country, w.origin)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Enqueue queues write of country of addr, write is dropped if queue is full
+func (l *L2) Enqueue(addr, country string, origin cache.Origin) {
+	if !l.available() {
+		return
+	}
+
+	select {
+	case l.queue <- write{addr: addr, country: country, origin: origin}:
+	default:
+		l.logger.Printf("L2 set [%v]: queue is full, write is dropped", addr)
+	}
+}
+
+// available returns false if L2 has failed recently
+func (l *L2) available() bool {
+	return l != nil && time.Now().UnixNano() >= atomic.LoadInt64(&l.down)
+}
+
+func (l *L2) fail(op, addr string, err error) {
+	atomic.StoreInt64(&l.down, time.Now().Add(l.retry).UnixNano())
+	l.logger.Printf("L2 %v [%v]: err : %v, skip L2 for %v", op, addr, err, l.retry)
+}
+
+// Get returns country of addr with its origin & remaining TTL (zero if value doesn't expire),
+// L2 isn't waited for after deadline or cancellation of ctx
+func (l *L2) Get(ctx context.Context, addr string) (country string, origin cache.Origin, ttl time.Duration, ok bool) {
+	if !l.available() {
+		return
+	}
+
+	value, ok, err := l.client.Get(ctx, l.prefix+addr)
+	if err != nil {
+		// gone client says nothing about L2, but L2 which doesn't answer within deadline is skipped
+		if err != context.Canceled {
+			l.fail("get", addr, err)
+		}
+		return "", origin, 0, false
+	}
+	if !ok {
+		return
+	}
+
+	var rec record
+	if err := json.Unmarshal([]byte(value), &rec); err != nil {
+		l.logger.Printf("L2 get [%v]: invalid value : %v", addr, err)
+		return "", origin, 0, false
+	}
+	if rec.Deadline != 0 {
+		if ttl = time.Until(time.Unix(0, rec.Deadline)); ttl <= 0 {
+			return "", origin, 0, false
+		}
+	}
+	origin = cache.Origin{Provider: rec.Provider, Fetched: rec.Fetched, Latency: rec.Latency}
+	return rec.Country, origin, ttl, true
+}
+
+// Set stores country of addr with its origin
+func (l *L2) Set(addr, country string, origin cache.Origin) {
+	if !l.available() {
+		return
+	}
+
+	rec := &record{
+		Country:  country,
+		Provider: origin.Provider,
+		Fetched:  origin.Fetched,
+		Latency:  origin.Latency,
+	}
+	if l.ttl > 0 {
+		rec.Deadline = time.Now().Add(l.ttl).UnixNano()
+	}
+	value, err := json.Marshal(rec)
+	if err != nil {
+		l.logger.Printf("L2 set [%v]: marshal err : %v", addr, err)
+		return
+	}
+	if err := l.client.Set(context.Background(), l.prefix+addr, string(value), l.ttl); err != nil {
+		l.fail("set", addr, err)
+	}
+}
+
+// Delete deletes answer about addr
+func (l *L2) Delete(addr string) {
+	if !l.available() {
+		return
+	}
+	if err := l.client.Del(context.Background(), l.prefix+addr); err != nil {
+		l.fail("delete", addr, err)
+	}
+}
+
+// scanCount - number of keys per step of scan
+const scanCount = 1000
+
+// DeleteFunc deletes all answers, for which match returns true, returns number of deleted answers
+func (l *L2) DeleteFunc(match filter) (n int, err error) {
+	if !l.available() {
+		return 0, nil
+	}
+
+	cursor := "0"
+	for {
+		var keys []string
+		if cursor, keys, err = l.client.Scan(context.Background(), cursor, l.prefix+"*", scanCount); err != nil {
+			l.fail("scan", l.prefix+"*", err)
+			return n, err
+		}
+		for _, key := range keys {
+			addr := strings.TrimPrefix(key, l.prefix)
+			country, origin, _, ok := l.Get(context.Background(), addr)
+			if !ok || !match(addr, origin.Provider) {
+				continue
+			}
+			if err = l.client.Del(context.Background(), key); err != nil {
+				l.fail("delete", addr, err)
+				return n, err
+			}
+			l.logger.Printf("L2 delete [%v]: country `%v` of provider [%v]", addr, country, origin.Provider)
+			n++
+		}
+		if cursor == "0" {
+			return n, nil
+		}
+	}
+}
+
+// Flush deletes all answers of L2 (keys with prefix), returns number of deleted answers
+func (l *L2) Flush() (n int, err error) {
+	if !l.available() {
+		return 0, nil
+	}
+
+	cursor := "0"
+	for {
+		var keys []string
+		if cursor, keys, err = l.client.Scan(context.Background(), cursor, l.prefix+"*", scanCount); err != nil {
+			l.fail("scan", l.prefix+"*", err)
+			return n, err
+		}
+		for _, key := range keys {
+			if err = l.client.Del(context.Background(), key); err != nil {
+				l.fail("delete", strings.TrimPrefix(key, l.prefix), err)
+				return n, err
+			}
+			n++
+		}
+		if cursor == "0" {
+			return n, nil
+		}
+	}
+}
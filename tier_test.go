@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/searchinform/cache"
+	"github.com/searchinform/resp"
+)
+
+// respServer - in-process stand-in of Redis server (GET, SET [PX], DEL, SCAN with prefix pattern
+// in one page), down server drops connections, hung server reads commands without answers
+type respServer struct {
+	listener net.Listener
+	conns    int64
+	down     int32
+	hung     int32
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newRESPServer(t *testing.T) *respServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen err:", err)
+	}
+	s := &respServer{listener: listener, values: map[string]string{}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&s.conns, 1)
+			if atomic.LoadInt32(&s.down) != 0 {
+				conn.Close()
+				continue
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *respServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := resp.ReadReply(r)
+		if err != nil || atomic.LoadInt32(&s.down) != 0 {
+			return
+		}
+		if atomic.LoadInt32(&s.hung) != 0 {
+			continue
+		}
+		var args []string
+		array, _ := reply.([]interface{})
+		for _, arg := range array {
+			str, _ := arg.(string)
+			args = append(args, str)
+		}
+
+		answer := "-ERR unknown command\r\n"
+		s.mu.Lock()
+		switch {
+		case len(args) == 2 && strings.ToUpper(args[0]) == "GET":
+			if value, ok := s.values[args[1]]; ok {
+				answer = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			} else {
+				answer = "$-1\r\n"
+			}
+		case len(args) >= 3 && strings.ToUpper(args[0]) == "SET":
+			s.values[args[1]], answer = args[2], "+OK\r\n"
+		case len(args) == 2 && strings.ToUpper(args[0]) == "DEL":
+			delete(s.values, args[1])
+			answer = ":1\r\n"
+		case len(args) >= 4 && strings.ToUpper(args[0]) == "SCAN" && strings.ToUpper(args[2]) == "MATCH":
+			var keys []string
+			for key := range s.values {
+				if strings.HasPrefix(key, strings.TrimSuffix(args[3], "*")) {
+					keys = append(keys, "$"+strconv.Itoa(len(key))+"\r\n"+key+"\r\n")
+				}
+			}
+			answer = "*2\r\n$1\r\n0\r\n*" + strconv.Itoa(len(keys)) + "\r\n" + strings.Join(keys, "")
+		}
+		s.mu.Unlock()
+		io.WriteString(conn, answer)
+	}
+}
+
+func (s *respServer) Conns() int64 {
+	return atomic.LoadInt64(&s.conns)
+}
+
+// Len returns number of stored values
+func (s *respServer) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.values)
+}
+
+func newTestL2(addr string, ttl, retry time.Duration, queue int) *L2 {
+	client := resp.NewClient(addr, "", 0, time.Second, 2)
+	return NewL2(client, "test:", ttl, retry, queue, 1, log.New(io.Discard, "", 0))
+}
+
+func TestL2(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv := newRESPServer(t)
+	l2 := newTestL2(srv.listener.Addr().String(), time.Hour, time.Minute, 1)
+
+	origin := cache.Origin{Provider: "p", Fetched: time.Now().UnixNano(), Latency: time.Millisecond}
+	l2.Set("1.2.3.4", "Testland", origin)
+	country, o, ttl, ok := l2.Get(ctx, "1.2.3.4")
+	if !ok || country != "Testland" || o != origin || ttl <= time.Hour-time.Minute || ttl > time.Hour {
+		t.Fatalf("Invalid answer of L2: %v %v %v %v", country, o, ttl, ok)
+	}
+
+	// answer with passed deadline is missed
+	srv.mu.Lock()
+	srv.values["test:5.6.7.8"] = `{"country":"Testland","deadline":1}`
+	srv.mu.Unlock()
+	if country, _, _, ok := l2.Get(ctx, "5.6.7.8"); ok {
+		t.Fatalf("Expired answer of L2 must be missed, but %v", country)
+	}
+
+	l2.Delete("1.2.3.4")
+	if country, _, _, ok := l2.Get(ctx, "1.2.3.4"); ok {
+		t.Fatalf("Deleted answer of L2 must be missed, but %v", country)
+	}
+}
+
+func TestL2Fallback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv := newRESPServer(t)
+	atomic.StoreInt32(&srv.down, 1)
+	l2 := newTestL2(srv.listener.Addr().String(), time.Hour, 100*time.Millisecond, 1)
+
+	if _, _, _, ok := l2.Get(ctx, "1.2.3.4"); ok {
+		t.Fatal("Get of unreachable L2 must miss")
+	}
+	conns := srv.Conns()
+
+	// L2 is skipped after failure
+	l2.Get(ctx, "1.2.3.4")
+	l2.Set("1.2.3.4", "Testland", cache.Origin{})
+	l2.Delete("1.2.3.4")
+	l2.Enqueue("1.2.3.4", "Testland", cache.Origin{})
+	if n := srv.Conns(); n != conns || len(l2.queue) != 0 {
+		t.Fatalf("L2 must be skipped, but %v new connections, %v queued writes", n-conns, len(l2.queue))
+	}
+
+	// L2 is retried after pause
+	time.Sleep(150 * time.Millisecond)
+	atomic.StoreInt32(&srv.down, 0)
+	l2.Set("1.2.3.4", "Testland", cache.Origin{})
+	if country, _, _, ok := l2.Get(ctx, "1.2.3.4"); !ok || country != "Testland" {
+		t.Fatalf("L2 must be retried after pause, but %v %v", country, ok)
+	}
+}
+
+func TestL2Queue(t *testing.T) {
+	t.Parallel()
+
+	srv := newRESPServer(t)
+	l2 := newTestL2(srv.listener.Addr().String(), time.Hour, time.Minute, 1)
+
+	// queue is full, so the second write is dropped
+	l2.Enqueue("1.2.3.4", "Testland", cache.Origin{})
+	l2.Enqueue("5.6.7.8", "Testland", cache.Origin{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l2.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for _, _, _, ok := l2.Get(ctx, "1.2.3.4"); !ok; _, _, _, ok = l2.Get(ctx, "1.2.3.4") {
+		if time.Now().After(deadline) {
+			t.Fatal("Queued write isn't written")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, _, ok := l2.Get(ctx, "5.6.7.8"); ok {
+		t.Fatal("Write to full queue must be dropped")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestResolveL2(t *testing.T) {
+	t.Parallel()
+
+	srv, stub := newRESPServer(t), newStub(t, "Testland", 0)
+	ctrl := newTestController(t, testConfig(stub))
+	ctrl.l2 = newTestL2(srv.listener.Addr().String(), time.Hour, time.Minute, 16)
+
+	// answer of L2 lives in L1 not longer than in L2
+	srv.mu.Lock()
+	deadline := time.Now().Add(10 * time.Second).UnixNano()
+	srv.values["test:1.2.3.4"] = `{"country":"Otherland","provider":"p","deadline":` + strconv.FormatInt(deadline, 10) + `}`
+	srv.mu.Unlock()
+	res, err := ctrl.resolveAddr(context.Background(), "1.2.3.4", "1.2.3.4", false)
+	if err != nil || res.Country != "Otherland" || res.Tier != tierL2 {
+		t.Fatalf("Invalid answer of L2: %+v err: %v", res, err)
+	}
+	if entry, ok := ctrl.cache.Peek("1.2.3.4"); !ok || entry.Deadline() > deadline+int64(time.Millisecond) {
+		t.Fatalf("Answer of L2 lives longer in L1: %v %v", entry, ok)
+	}
+
+	// provider answers if L2 is down
+	atomic.StoreInt32(&srv.down, 1)
+	res, err = ctrl.resolveAddr(context.Background(), "5.6.7.8", "5.6.7.8", false)
+	if err != nil || res.Country != "Testland" || res.Tier != "" || stub.Requests() != 1 {
+		t.Fatalf("Invalid answer with L2 down: %+v err: %v", res, err)
+	}
+}
+
+func TestResolveL2Hung(t *testing.T) {
+	t.Parallel()
+
+	srv, stub := newRESPServer(t), newStub(t, "Testland", 0)
+	atomic.StoreInt32(&srv.hung, 1)
+	ctrl := newTestController(t, testConfig(stub))
+	// L2 without timeout is waited for only within deadline of request
+	client := resp.NewClient(srv.listener.Addr().String(), "", 0, 0, 2)
+	ctrl.l2 = NewL2(client, "test:", time.Hour, time.Minute, 1, 1, log.New(io.Discard, "", 0))
+
+	// gone client doesn't make L2 skipped
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if res, err := ctrl.resolveAddr(ctx, "1.2.3.4", "1.2.3.4", false); err == nil || time.Since(start) > time.Second {
+		t.Fatalf("Cancelled request must fail at once, but %+v err: %v in %v", res, err, time.Since(start))
+	}
+	if !ctrl.l2.available() {
+		t.Fatal("L2 mustn't be skipped after cancellation of request")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if res, err := ctrl.resolveAddr(ctx, "1.2.3.4", "1.2.3.4", false); err == nil || time.Since(start) > time.Second {
+		t.Fatalf("Request must fail at deadline, but %+v err: %v in %v", res, err, time.Since(start))
+	}
+	if ctrl.l2.available() || stub.Requests() != 0 {
+		t.Fatalf("L2, which doesn't answer within deadline, must be skipped (%v), provider isn't requested (%v)",
+			ctrl.l2.available(), stub.Requests())
+	}
+}
+
+func TestL2Flush(t *testing.T) {
+	t.Parallel()
+
+	srv := newRESPServer(t)
+	l2 := newTestL2(srv.listener.Addr().String(), time.Hour, time.Minute, 1)
+
+	for _, addr := range []string{"1.2.3.4", "10.0.0.1", "10.0.0.2"} {
+		l2.Set(addr, "Testland", cache.Origin{Provider: "p" + addr[:2]})
+	}
+	srv.mu.Lock()
+	srv.values["other:1.2.3.4"] = "not answer of L2"
+	srv.mu.Unlock()
+
+	// answers of provider
+	if n, err := l2.DeleteFunc(func(addr string, providers ...string) bool { return providers[0] == "p10" }); err != nil || n != 2 {
+		t.Fatalf("Invalid deletion: %v err: %v", n, err)
+	}
+	if n, err := l2.Flush(); err != nil || n != 1 {
+		t.Fatalf("Invalid flush: %v err: %v", n, err)
+	}
+	// keys without prefix are kept
+	if n := srv.Len(); n != 1 {
+		t.Fatalf("Must be 1 value, but %v", n)
+	}
+
+	var disabled *L2
+	if n, err := disabled.Flush(); err != nil || n != 0 {
+		t.Fatalf("Flush of disabled L2: %v err: %v", n, err)
+	}
+}